@@ -1,57 +1,115 @@
 package auth
 
 import (
+	"context"
 	"encoding/base64"
+	"maps"
 	"net/http"
 	"strings"
+	"sync/atomic"
+
+	"student-server/metrics"
 )
 
-// Map storing valid username-password pairs (for demo purposes)
-var validUsers = map[string]string{
+// DefaultUsers are the demo username-password pairs accepted unless the
+// configuration lists other users
+var DefaultUsers = map[string]string{
 	"admin": "password123",
 	"user1": "pass1",
 	"user2": "pass2",
 }
 
-// BasicAuthMiddleware ensures only authenticated users access certain routes
-func BasicAuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
+// validUsers is swapped as a whole, so a reload never exposes a
+// half-updated list to requests being authenticated
+var validUsers atomic.Pointer[map[string]string]
 
-		// Format: "Basic base64(username:password)"
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || parts[0] != "Basic" {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
+func init() {
+	SetUsers(DefaultUsers)
+}
 
-		decoded, err := base64.StdEncoding.DecodeString(parts[1])
-		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+// SetUsers replaces the accepted username-password pairs. It is safe to
+// call while requests are being served.
+func SetUsers(users map[string]string) {
+	users = maps.Clone(users)
+	validUsers.Store(&users)
+}
+
+type contextKey struct{}
+
+// ParseBasicAuth extracts the username and password from an
+// Authorization header value of the form "Basic base64(username:password)"
+func ParseBasicAuth(header string) (username, password string, ok bool) {
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 || parts[0] != "Basic" {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", "", false
+	}
+
+	credentials := strings.SplitN(string(decoded), ":", 2)
+	if len(credentials) != 2 {
+		return "", "", false
+	}
+	return credentials[0], credentials[1], true
+}
+
+// ValidateCredentials reports whether username and password match a known user
+func ValidateCredentials(username, password string) bool {
+	validPassword, exists := (*validUsers.Load())[username]
+	return exists && validPassword == password
+}
+
+// Authenticate validates an Authorization header value and returns the
+// authenticated username
+func Authenticate(header string) (string, bool) {
+	username, password, ok := ParseBasicAuth(header)
+	if !ok || !ValidateCredentials(username, password) {
+		return "", false
+	}
+	return username, true
+}
+
+// WithUser returns a copy of ctx carrying the authenticated username
+func WithUser(ctx context.Context, username string) context.Context {
+	return context.WithValue(ctx, contextKey{}, username)
+}
+
+// UserFromContext returns the authenticated username stored in ctx, if any
+func UserFromContext(ctx context.Context) (string, bool) {
+	username, ok := ctx.Value(contextKey{}).(string)
+	return username, ok
+}
+
+// BasicAuthMiddleware ensures only authenticated users access certain
+// routes. A verified client certificate matching a ClientCertRule is
+// accepted in place of basic auth credentials.
+func BasicAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if principal, role, ok := AuthenticateTLS(r.TLS); ok {
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal, role)))
 			return
 		}
 
-		credentials := strings.SplitN(string(decoded), ":", 2)
-		if len(credentials) != 2 {
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			metrics.AuthFailures.WithLabelValues("http", "missing").Inc()
+			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		username, password := credentials[0], credentials[1]
-
-		// Validate credentials
-		if validPassword, exists := validUsers[username]; !exists || validPassword != password {
+		username, ok := Authenticate(authHeader)
+		if !ok {
+			metrics.AuthFailures.WithLabelValues("http", "invalid").Inc()
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
 		// If authentication succeeds, pass request to next handler
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), username, "")))
 	})
 
 }
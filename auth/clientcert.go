@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"student-server/logging"
+)
+
+// ClientCertRule maps client certificates to a principal. Match is a
+// certificate field and value: "cn:<subject common name>",
+// "dns:<DNS SAN>", "uri:<URI SAN>" or "email:<email SAN>".
+type ClientCertRule struct {
+	Match     string `yaml:"match" toml:"match"`
+	Principal string `yaml:"principal" toml:"principal"` // defaults to the matched value
+	Role      string `yaml:"role" toml:"role"`
+}
+
+// Validate reports a rule that can never match
+func (rule ClientCertRule) Validate() error {
+	field, value, _ := strings.Cut(rule.Match, ":")
+	switch field {
+	case "cn", "dns", "uri", "email":
+	default:
+		return fmt.Errorf("match %q must start with cn:, dns:, uri: or email:", rule.Match)
+	}
+	if value == "" {
+		return fmt.Errorf("match %q has no value", rule.Match)
+	}
+	return nil
+}
+
+func (rule ClientCertRule) matches(cert *x509.Certificate) bool {
+	field, value, _ := strings.Cut(rule.Match, ":")
+	switch field {
+	case "cn":
+		return cert.Subject.CommonName == value
+	case "dns":
+		return slices.ContainsFunc(cert.DNSNames, func(name string) bool { return strings.EqualFold(name, value) })
+	case "uri":
+		return slices.ContainsFunc(cert.URIs, func(uri *url.URL) bool { return uri.String() == value })
+	case "email":
+		return slices.ContainsFunc(cert.EmailAddresses, func(email string) bool { return strings.EqualFold(email, value) })
+	}
+	return false
+}
+
+var clientCertRules atomic.Pointer[[]ClientCertRule]
+
+// SetClientCertRules replaces the rules that map client certificates to
+// principals. It is safe to call while requests are being served.
+func SetClientCertRules(rules []ClientCertRule) {
+	rules = slices.Clone(rules)
+	clientCertRules.Store(&rules)
+}
+
+// AuthenticateTLS returns the principal and role of the first rule
+// matching the verified client certificate of a TLS connection. Without a
+// verified certificate, or a rule matching it, ok is false.
+func AuthenticateTLS(state *tls.ConnectionState) (principal, role string, ok bool) {
+	rules := clientCertRules.Load()
+	if state == nil || len(state.VerifiedChains) == 0 || rules == nil {
+		return "", "", false
+	}
+	cert := state.VerifiedChains[0][0]
+	for _, rule := range *rules {
+		if rule.matches(cert) {
+			principal = rule.Principal
+			if principal == "" {
+				_, principal, _ = strings.Cut(rule.Match, ":")
+			}
+			return principal, rule.Role, true
+		}
+	}
+	return "", "", false
+}
+
+type roleKey struct{}
+
+// WithPrincipal returns a copy of ctx for a request authenticated as
+// principal with role, for handlers and logs alike
+func WithPrincipal(ctx context.Context, principal, role string) context.Context {
+	ctx = WithUser(ctx, principal)
+	if role != "" {
+		ctx = WithRole(ctx, role)
+	}
+	return logging.WithPrincipal(ctx, principal)
+}
+
+// WithRole returns a copy of ctx carrying the role of the authenticated
+// principal
+func WithRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, roleKey{}, role)
+}
+
+// RoleFromContext returns the role stored in ctx, if any. Basic auth users
+// have no role.
+func RoleFromContext(ctx context.Context) (string, bool) {
+	role, ok := ctx.Value(roleKey{}).(string)
+	return role, ok && role != ""
+}
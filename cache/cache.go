@@ -0,0 +1,122 @@
+// Package cache keeps recently read values in memory so repeated reads
+// skip the database
+package cache
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache stores encoded values by key for a limited time. LRU keeps them in
+// the process; a shared cache such as Redis can implement Cache too, so
+// instances share entries and see each other's invalidations.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool)
+	Set(ctx context.Context, key string, value []byte)
+	Delete(ctx context.Context, key string)
+	// DeletePrefix drops every entry whose key starts with prefix
+	DeletePrefix(ctx context.Context, prefix string)
+}
+
+// LRU is a Cache holding up to a fixed number of entries, each for up to a
+// fixed time. When full, the least recently used entry makes room.
+type LRU struct {
+	// Now tells the time, time.Now unless set
+	Now func() time.Time
+
+	mu         sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	order      *list.List // front is the most recently used
+	entries    map[string]*list.Element
+}
+
+type entry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewLRU returns an empty cache of up to maxEntries entries that expire
+// after ttl. A maxEntries below 1 is taken as 1.
+func NewLRU(maxEntries int, ttl time.Duration) *LRU {
+	maxEntries = max(maxEntries, 1)
+	return &LRU{maxEntries: maxEntries, ttl: ttl, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+// Get returns the value stored for key, unless it has expired
+func (c *LRU) Get(_ context.Context, key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if c.now().After(e.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return e.value, true
+}
+
+// Set stores value for key, evicting the least recently used entry if the
+// cache is full. The cache keeps value, so callers must not change it.
+func (c *LRU) Set(_ context.Context, key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := c.now().Add(c.ttl)
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*entry)
+		e.value, e.expires = value, expires
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&entry{key: key, value: value, expires: expires})
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+	}
+}
+
+// Delete drops the entry for key
+func (c *LRU) Delete(_ context.Context, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+}
+
+// DeletePrefix drops every entry whose key starts with prefix
+func (c *LRU) DeletePrefix(_ context.Context, prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, el := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			c.remove(el)
+		}
+	}
+}
+
+// Len returns the number of entries, expired ones included
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *LRU) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+func (c *LRU) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*entry).key)
+}
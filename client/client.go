@@ -0,0 +1,132 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"student-server/models"
+)
+
+// Client talks to a running student server over HTTP
+type Client struct {
+	BaseURL    string
+	Username   string
+	Password   string
+	HTTPClient *http.Client
+}
+
+// APIError is returned when the server answers with a non-2xx status
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// New creates a client for the server at baseURL
+func New(baseURL, username, password string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		Username:   username,
+		Password:   password,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// ListStudents fetches all students
+func (c *Client) ListStudents() ([]models.Student, error) {
+	var students []models.Student
+	if err := c.do(http.MethodGet, "/students", nil, &students); err != nil {
+		return nil, err
+	}
+	return students, nil
+}
+
+// GetStudent fetches a single student by ID
+func (c *Client) GetStudent(id string) (*models.Student, error) {
+	var student models.Student
+	if err := c.do(http.MethodGet, studentPath(id), nil, &student); err != nil {
+		return nil, err
+	}
+	return &student, nil
+}
+
+// studentPath is the path of the student with id, escaped so an id can't
+// reach another endpoint
+func studentPath(id string) string {
+	return "/students/" + url.PathEscape(id)
+}
+
+// CreateStudent adds a new student and returns the server's message
+func (c *Client) CreateStudent(fields map[string]interface{}) (string, error) {
+	var msg string
+	err := c.do(http.MethodPost, "/students", fields, &msg)
+	return msg, err
+}
+
+// UpdateStudent sends only the given fields for the student with id
+func (c *Client) UpdateStudent(id string, fields map[string]interface{}) (string, error) {
+	var msg string
+	err := c.do(http.MethodPut, studentPath(id), fields, &msg)
+	return msg, err
+}
+
+// DeleteStudent removes the student with id
+func (c *Client) DeleteStudent(id string) (string, error) {
+	var msg string
+	err := c.do(http.MethodDelete, studentPath(id), nil, &msg)
+	return msg, err
+}
+
+// do sends the request and decodes the response into out. A *string out
+// receives the raw body text, anything else is decoded as JSON.
+func (c *Client) do(method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+	}
+
+	if s, ok := out.(*string); ok {
+		*s = strings.TrimSpace(string(data))
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"student-server/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Supported output formats
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatYAML  = "yaml"
+)
+
+// studentView is the shape students are printed in
+type studentView struct {
+	ID        uint      `json:"id" yaml:"id"`
+	Name      string    `json:"name" yaml:"name"`
+	Age       int       `json:"age" yaml:"age"`
+	Grade     string    `json:"grade" yaml:"grade"`
+	CreatedAt time.Time `json:"created_at" yaml:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" yaml:"updated_at"`
+}
+
+func toView(s models.Student) studentView {
+	return studentView{
+		ID:        s.ID,
+		Name:      s.Name,
+		Age:       s.Age,
+		Grade:     s.Grade,
+		CreatedAt: s.CreatedAt,
+		UpdatedAt: s.UpdatedAt,
+	}
+}
+
+// ValidFormat reports whether format is one PrintStudents understands
+func ValidFormat(format string) bool {
+	switch format {
+	case FormatTable, FormatJSON, FormatYAML:
+		return true
+	}
+	return false
+}
+
+// PrintStudents writes students to w in the given format
+func PrintStudents(w io.Writer, format string, students []models.Student) error {
+	views := make([]studentView, 0, len(students))
+	for _, s := range students {
+		views = append(views, toView(s))
+	}
+	return printViews(w, format, views)
+}
+
+// PrintStudent writes a single student to w in the given format
+func PrintStudent(w io.Writer, format string, student models.Student) error {
+	view := toView(student)
+	switch format {
+	case FormatJSON:
+		return writeJSON(w, view)
+	case FormatYAML:
+		return yaml.NewEncoder(w).Encode(view)
+	}
+	return printViews(w, format, []studentView{view})
+}
+
+func printViews(w io.Writer, format string, views []studentView) error {
+	switch format {
+	case FormatJSON:
+		return writeJSON(w, views)
+	case FormatYAML:
+		return yaml.NewEncoder(w).Encode(views)
+	case FormatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tAGE\tGRADE")
+		for _, v := range views {
+			fmt.Fprintf(tw, "%d\t%s\t%d\t%s\n", v.ID, v.Name, v.Age, v.Grade)
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("unknown output format %q", format)
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
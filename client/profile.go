@@ -0,0 +1,73 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Profile holds connection settings for one server
+type Profile struct {
+	URL      string `yaml:"url"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// profilesFile is the on-disk layout of the profiles file:
+//
+//	default: prod
+//	profiles:
+//	  prod:
+//	    url: https://students.example.com
+//	    username: admin
+//	    password: secret
+type profilesFile struct {
+	Default  string             `yaml:"default"`
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+// DefaultProfilesPath returns the profiles file under the user's config directory
+func DefaultProfilesPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "student-server", "profiles.yaml")
+}
+
+// LoadProfile reads the named profile from path. An empty name selects the
+// file's default profile. A missing file is not an error unless a profile
+// was asked for by name.
+func LoadProfile(path, name string) (Profile, error) {
+	if path == "" {
+		return Profile{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && name == "" {
+			return Profile{}, nil
+		}
+		return Profile{}, fmt.Errorf("reading profiles file: %w", err)
+	}
+
+	var file profilesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return Profile{}, fmt.Errorf("parsing profiles file %s: %w", path, err)
+	}
+
+	if name == "" {
+		name = file.Default
+	}
+	if name == "" {
+		return Profile{}, nil
+	}
+
+	profile, ok := file.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("profile %q not found in %s", name, path)
+	}
+	return profile, nil
+}
@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"student-server/config"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// cfg is the effective configuration; flags write straight into it
+var cfg = config.Default()
+
+var configFormat string
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the server configuration",
+	Long: `Show or check the configuration "serve" would run with. These commands
+accept the same flags as serve, so a command line can be checked before
+it is used.`,
+}
+
+var configPrintCmd = &cobra.Command{
+	Use:   "print",
+	Short: "Print the effective configuration with passwords redacted",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(cmd); err != nil {
+			return err
+		}
+		out, err := cfg.Redacted().Marshal(configFormat)
+		if err != nil {
+			return err
+		}
+		_, err = cmd.OutOrStdout().Write(out)
+		return err
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check that the configuration loads and is valid",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(cmd); err != nil {
+			return err
+		}
+		source := "built-in defaults"
+		if path := config.FindFile(configFile); path != "" {
+			source = path
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Configuration is valid (%s)\n", source)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configPrintCmd, configValidateCmd)
+	addServeFlags(configCmd.PersistentFlags())
+	addDatabaseFlags(configCmd)
+	configPrintCmd.Flags().StringVar(&configFormat, "format", "yaml", "Output format: yaml or toml")
+}
+
+// addServeFlags adds the flags that override the server configuration
+func addServeFlags(fs *pflag.FlagSet) {
+	fs.IntVarP(&cfg.Server.Port, "port", "p", cfg.Server.Port, "Port to run the server on")
+	fs.IntVar(&cfg.Server.GRPCPort, "grpc-port", cfg.Server.GRPCPort, "Port for the gRPC server (0 to serve gRPC on the HTTP port, -1 to disable)")
+	fs.StringVar(&cfg.TLS.Cert, "tls-cert", cfg.TLS.Cert, "PEM certificate chain; serves HTTPS and gRPC over TLS when set with --tls-key")
+	fs.StringVar(&cfg.TLS.Key, "tls-key", cfg.TLS.Key, "PEM private key for --tls-cert")
+	fs.StringVar(&cfg.TLS.MinVersion, "tls-min-version", cfg.TLS.MinVersion, "Oldest TLS version accepted: 1.2 or 1.3")
+	fs.DurationVar(&cfg.TLS.ReloadInterval, "tls-reload-interval", cfg.TLS.ReloadInterval, "How often the certificate files are checked for changes (0 to only reload on SIGHUP)")
+	fs.IntVar(&cfg.TLS.RedirectPort, "http-redirect-port", cfg.TLS.RedirectPort, "Plain HTTP port that redirects to HTTPS (0 to disable)")
+	fs.DurationVar(&cfg.TLS.HSTSMaxAge, "hsts-max-age", cfg.TLS.HSTSMaxAge, "max-age of the Strict-Transport-Security header sent over TLS (0 to leave it out)")
+	fs.StringVar(&cfg.TLS.ClientAuth, "tls-client-auth", cfg.TLS.ClientAuth, "Client certificates: none, optional (verified if presented) or require")
+	fs.StringVar(&cfg.TLS.ClientCA, "tls-client-ca", cfg.TLS.ClientCA, "PEM bundle of the CAs client certificates are verified against")
+	fs.DurationVar(&cfg.Server.ReadHeaderTimeout, "read-header-timeout", cfg.Server.ReadHeaderTimeout, "Time limit for reading request headers (0 for no limit)")
+	fs.DurationVar(&cfg.Server.ReadTimeout, "read-timeout", cfg.Server.ReadTimeout, "Time limit for reading a whole request, body included (0 for no limit)")
+	fs.DurationVar(&cfg.Server.WriteTimeout, "write-timeout", cfg.Server.WriteTimeout, "Time limit for writing a response; event streams are exempt (0 for no limit)")
+	fs.DurationVar(&cfg.Server.IdleTimeout, "idle-timeout", cfg.Server.IdleTimeout, "How long an idle keep-alive connection stays open (0 for no limit)")
+	fs.Int64Var(&cfg.Server.MaxBodyBytes, "max-body-bytes", cfg.Server.MaxBodyBytes, "Largest request body accepted; larger ones get 413 (0 for no limit)")
+	fs.DurationVar(&cfg.Server.DrainDelay, "drain-delay", cfg.Server.DrainDelay, "How long /readyz reports failure before the server stops accepting connections on shutdown")
+	fs.DurationVar(&cfg.Server.ShutdownTimeout, "shutdown-timeout", cfg.Server.ShutdownTimeout, "How long requests, event streams and WebSockets in flight may take to finish on shutdown")
+	fs.BoolVar(&cfg.RateLimit.Enabled, "rate-limit", cfg.RateLimit.Enabled, "Limit how fast each client may call the API (limits are set per route group in the config file)")
+	fs.StringSliceVar(&cfg.RateLimit.TrustedProxies, "trusted-proxies", cfg.RateLimit.TrustedProxies, "Addresses or CIDR ranges of proxies whose X-Forwarded-For header identifies the client")
+	fs.StringVar(&cfg.RateLimit.APIKeyHeader, "api-key-header", cfg.RateLimit.APIKeyHeader, "Header holding the API key that api_key rate limits count by")
+	fs.StringSliceVar(&cfg.CORS.AllowedOrigins, "cors-origins", cfg.CORS.AllowedOrigins, "Origins browsers may call the API from, e.g. https://app.example.com or https://*.example.com (none turns CORS off)")
+	fs.StringSliceVar(&cfg.Webhooks.AllowedNetworks, "webhook-allowed-networks", cfg.Webhooks.AllowedNetworks, "Private or loopback addresses or CIDR ranges webhooks may still be sent to")
+	fs.BoolVar(&cfg.CORS.AllowCredentials, "cors-credentials", cfg.CORS.AllowCredentials, "Let browsers send cookies and HTTP auth with cross-origin requests")
+	fs.BoolVar(&cfg.Compression.Enabled, "compression", cfg.Compression.Enabled, "Compress responses with zstd, brotli or gzip when the client accepts it")
+	fs.IntVar(&cfg.Compression.MinBytes, "compression-min-bytes", cfg.Compression.MinBytes, "Smallest response body worth compressing")
+	fs.BoolVar(&cfg.Cache.Enabled, "cache", cfg.Cache.Enabled, "Cache student reads in memory; each instance keeps its own cache, and only the instance that made a change drops its copies")
+	fs.IntVar(&cfg.Cache.MaxEntries, "cache-max-entries", cfg.Cache.MaxEntries, "Most students and student lists kept in the cache")
+	fs.DurationVar(&cfg.Cache.TTL, "cache-ttl", cfg.Cache.TTL, "How long a cached read is kept; changes made through other instances show up after at most this long")
+	fs.DurationVar(&cfg.Server.PrimaryReadWindow, "primary-read-window", cfg.Server.PrimaryReadWindow, "How long after a client's write its reads go to the primary instead of a replica")
+	fs.BoolVar(&cfg.Database.AutoMigrate, "auto-migrate", cfg.Database.AutoMigrate, "Apply pending database migrations on startup")
+	fs.DurationVar(&cfg.Database.SlowQueryThreshold, "slow-query-threshold", cfg.Database.SlowQueryThreshold, "Log database statements slower than this as warnings")
+	fs.IntVar(&cfg.Events.History, "event-history", cfg.Events.History, "Number of recent student events kept for resuming event streams")
+	fs.BoolVar(&cfg.Events.OutboxLog, "outbox-log", cfg.Events.OutboxLog, "Log every published student event")
+	fs.StringVar(&cfg.Events.NATSURL, "nats-url", cfg.Events.NATSURL, "Publish student events to this NATS server, e.g. nats://localhost:4222")
+	fs.StringVar(&cfg.Events.NATSSubjectPrefix, "nats-subject-prefix", cfg.Events.NATSSubjectPrefix, "Subject prefix for events published to NATS")
+	fs.DurationVar(&cfg.Timeouts.Read, "query-timeout-read", cfg.Timeouts.Read, "Time limit for fetching a single record (0 for no limit)")
+	fs.DurationVar(&cfg.Timeouts.List, "query-timeout-list", cfg.Timeouts.List, "Time limit for list and GraphQL requests (0 for no limit)")
+	fs.DurationVar(&cfg.Timeouts.Write, "query-timeout-write", cfg.Timeouts.Write, "Time limit for creating, updating and deleting (0 for no limit)")
+	fs.StringVar(&cfg.Logging.Format, "log-format", cfg.Logging.Format, "Log output format: text or json")
+	fs.StringVar(&cfg.Logging.Level, "log-level", cfg.Logging.Level, "Minimum log level: debug, info, warn or error")
+	fs.StringVar(&cfg.Tracing.Exporter, "trace-exporter", cfg.Tracing.Exporter, "Where to send traces: none, stdout or otlp")
+	fs.StringVar(&cfg.Tracing.Endpoint, "otlp-endpoint", cfg.Tracing.Endpoint, "OTLP/gRPC collector address (default $OTEL_EXPORTER_OTLP_ENDPOINT or localhost:4317)")
+	fs.BoolVar(&cfg.Tracing.Insecure, "otlp-insecure", cfg.Tracing.Insecure, "Connect to the OTLP collector without TLS")
+	fs.Float64Var(&cfg.Tracing.SampleRatio, "trace-sample-ratio", cfg.Tracing.SampleRatio, "Fraction of new traces to record (0 to 1); traces started upstream follow the caller's decision")
+	fs.IntVar(&cfg.WebSocket.MaxSubscriptions, "ws-max-subscriptions", cfg.WebSocket.MaxSubscriptions, "Maximum topics a single WebSocket connection may subscribe to")
+	fs.IntVar(&cfg.GraphQL.MaxDepth, "graphql-max-depth", cfg.GraphQL.MaxDepth, "Maximum nesting depth of a GraphQL query (0 for no limit)")
+	fs.IntVar(&cfg.GraphQL.MaxComplexity, "graphql-max-complexity", cfg.GraphQL.MaxComplexity, "Maximum estimated cost of a GraphQL query (0 for no limit)")
+	fs.BoolVar(&cfg.Features.GraphQL, "graphql", cfg.Features.GraphQL, "Serve /graphql")
+	fs.BoolVar(&cfg.Features.WebSocket, "websocket", cfg.Features.WebSocket, "Serve /ws")
+	fs.BoolVar(&cfg.Features.Events, "events", cfg.Features.Events, "Serve /students/events")
+	fs.BoolVar(&cfg.Features.Webhooks, "webhooks", cfg.Features.Webhooks, "Serve /webhooks and deliver webhooks")
+	fs.BoolVar(&cfg.Features.Metrics, "metrics", cfg.Features.Metrics, "Serve /metrics")
+}
+
+// flagEnvPrefix prefixes the environment variable form of every flag, e.g.
+// STUDENT_SERVER_LOG_LEVEL for --log-level
+const flagEnvPrefix = "STUDENT_SERVER_"
+
+// loadConfig builds cfg from, in increasing precedence, the defaults, the
+// config file, the environment and the flags given to cmd
+func loadConfig(cmd *cobra.Command) error {
+	// The flags have already been parsed into cfg; remember the ones given
+	// so they can be applied again on top of the other layers
+	var given []func() error
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		// String() of a list flag is "[a,b]", which Set doesn't parse back
+		if list, ok := f.Value.(pflag.SliceValue); ok {
+			values := list.GetSlice()
+			given = append(given, func() error { return list.Replace(values) })
+			return
+		}
+		value := f.Value.String()
+		given = append(given, func() error { return f.Value.Set(value) })
+	})
+
+	cfg = config.Default()
+	if path := config.FindFile(configFile); path != "" {
+		if err := config.LoadFile(&cfg, path); err != nil {
+			return err
+		}
+	}
+	if err := config.ApplyEnv(&cfg); err != nil {
+		return err
+	}
+
+	var envErr error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Name == "config" || f.Name == "help" || envErr != nil {
+			return
+		}
+		name := flagEnvPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if value, ok := os.LookupEnv(name); ok {
+			set := f.Value.Set
+			if list, ok := f.Value.(pflag.SliceValue); ok {
+				// Set adds to a list once it has been set, as on a reload
+				set = func(value string) error {
+					return list.Replace(strings.FieldsFunc(value, func(r rune) bool { return r == ',' }))
+				}
+			}
+			if err := set(value); err != nil {
+				envErr = fmt.Errorf("invalid %s %q: %w", name, value, err)
+			}
+		}
+	})
+	if envErr != nil {
+		return envErr
+	}
+
+	for _, apply := range given {
+		if err := apply(); err != nil {
+			return err
+		}
+	}
+	return cfg.Validate()
+}
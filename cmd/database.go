@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"student-server/database"
+
+	"github.com/spf13/cobra"
+)
+
+// addDatabaseFlags adds the flags that choose the database to cmd and its
+// subcommands
+func addDatabaseFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&cfg.Database.Driver, "db", cfg.Database.Driver, "Database driver, postgres or sqlite")
+	cmd.PersistentFlags().StringVar(&cfg.Database.Path, "db-path", cfg.Database.Path, "SQLite database file")
+}
+
+// connectDB loads the configuration for cmd and connects to the database
+// it describes
+func connectDB(cmd *cobra.Command) error {
+	if err := loadConfig(cmd); err != nil {
+		return err
+	}
+	database.SlowQueryThreshold = cfg.Database.SlowQueryThreshold
+	return database.ConnectDB(cfg.Database.Config)
+}
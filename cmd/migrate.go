@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"text/tabwriter"
+
+	"student-server/database"
+
+	"github.com/spf13/cobra"
+)
+
+var migrationsDir string
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Manage the database schema",
+	Long: `Apply, roll back and inspect the versioned SQL migrations compiled into
+the server. Applied migrations are recorded in the schema_migrations table,
+and a database lock keeps concurrent runs from applying the same migration.`,
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Apply all pending migrations",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := newMigrator(cmd)
+		if err != nil {
+			return err
+		}
+		applied, err := m.Up()
+		for _, migration := range applied {
+			fmt.Fprintf(cmd.OutOrStdout(), "Applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "No pending migrations")
+		}
+		return err
+	},
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down [steps]",
+	Short: "Roll back the last applied migrations (default 1)",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		steps := 1
+		if len(args) == 1 {
+			var err error
+			if steps, err = strconv.Atoi(args[0]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[0])
+			}
+		}
+
+		m, err := newMigrator(cmd)
+		if err != nil {
+			return err
+		}
+		rolledBack, err := m.Down(steps)
+		for _, migration := range rolledBack {
+			fmt.Fprintf(cmd.OutOrStdout(), "Rolled back %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(rolledBack) == 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "No applied migrations")
+		}
+		return err
+	},
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show which migrations have been applied",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := newMigrator(cmd)
+		if err != nil {
+			return err
+		}
+		status, err := m.Status()
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range status {
+			appliedAt := "pending"
+			if s.Applied {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(tw, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return tw.Flush()
+	},
+}
+
+var migrateCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create empty up and down scripts for a new migration",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		paths, err := database.CreateMigration(migrationsDir, args[0])
+		for _, path := range paths {
+			fmt.Fprintf(cmd.OutOrStdout(), "Created %s\n", path)
+		}
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+	migrateCmd.AddCommand(migrateUpCmd, migrateDownCmd, migrateStatusCmd, migrateCreateCmd)
+	addDatabaseFlags(migrateCmd)
+	migrateCreateCmd.Flags().StringVar(&migrationsDir, "dir", "database/migrations", "Directory holding the migration files")
+}
+
+func newMigrator(cmd *cobra.Command) (*database.Migrator, error) {
+	if err := connectDB(cmd); err != nil {
+		return nil, err
+	}
+	return database.NewMigratorFor(database.DB)
+}
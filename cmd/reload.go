@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"errors"
+	"log/slog"
+
+	"student-server/auth"
+	"student-server/config"
+	"student-server/logging"
+	"student-server/middleware"
+	"student-server/ratelimit"
+	"student-server/tlsconfig"
+	"student-server/webhooks"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// certs serves the TLS certificate while the server runs with TLS
+	certs *tlsconfig.CertReloader
+
+	// limiter enforces the rate limits while the server runs
+	limiter *ratelimit.Limiter
+)
+
+// reloaders apply the settings that can change while the server runs, by
+// their config file key. Each one copies its setting from loaded into cfg
+// and puts it into effect.
+var reloaders = map[string]func(loaded config.Config) error{
+	"logging.level": func(loaded config.Config) error {
+		cfg.Logging.Level = loaded.Logging.Level
+		return logging.SetLevel(loaded.Logging.Level)
+	},
+	"auth.users": func(loaded config.Config) error {
+		cfg.Auth.Users = loaded.Auth.Users
+		auth.SetUsers(loaded.Auth.Users)
+		return nil
+	},
+	"auth.client_certs": func(loaded config.Config) error {
+		cfg.Auth.ClientCerts = loaded.Auth.ClientCerts
+		auth.SetClientCertRules(loaded.Auth.ClientCerts)
+		return nil
+	},
+	"tls.cert":                   reloadCertFiles,
+	"tls.key":                    reloadCertFiles,
+	"rate_limit.enabled":         reloadRateLimits,
+	"rate_limit.trusted_proxies": reloadRateLimits,
+	"rate_limit.api_key_header":  reloadRateLimits,
+	"rate_limit.groups":          reloadRateLimits,
+	"cors.allowed_origins":       reloadCORS,
+	"cors.allowed_methods":       reloadCORS,
+	"cors.allowed_headers":       reloadCORS,
+	"cors.exposed_headers":       reloadCORS,
+	"cors.allow_credentials":     reloadCORS,
+	"cors.max_age":               reloadCORS,
+	"webhooks.allowed_networks": func(loaded config.Config) error {
+		if err := webhooks.SetConfig(loaded.Webhooks); err != nil {
+			return err
+		}
+		cfg.Webhooks = loaded.Webhooks
+		return nil
+	},
+}
+
+// reloadCORS puts the cross-origin policy in loaded into effect
+func reloadCORS(loaded config.Config) error {
+	if err := middleware.SetCORSPolicy(loaded.CORS); err != nil {
+		return err
+	}
+	cfg.CORS = loaded.CORS
+	return nil
+}
+
+// reloadRateLimits puts the rate limits in loaded into effect. Clients keep
+// the tokens they have left.
+func reloadRateLimits(loaded config.Config) error {
+	if err := limiter.SetConfig(loaded.RateLimit); err != nil {
+		return err
+	}
+	cfg.RateLimit = loaded.RateLimit
+	return nil
+}
+
+// reloadCertFiles switches to the certificate files in loaded. Turning TLS
+// on or off needs a restart.
+func reloadCertFiles(loaded config.Config) error {
+	if certs == nil || !loaded.TLS.Enabled() {
+		return errors.New("turning TLS on or off needs a restart")
+	}
+	if err := certs.SetFiles(loaded.TLS.Cert, loaded.TLS.Key); err != nil {
+		return err
+	}
+	cfg.TLS.Cert, cfg.TLS.Key = loaded.TLS.Cert, loaded.TLS.Key
+	return nil
+}
+
+// reloadConfig loads the configuration for cmd again, as on SIGHUP, and
+// applies the reloadable settings that changed. An invalid configuration
+// is rejected as a whole and the running settings are kept; changes to
+// other settings are logged as needing a restart.
+func reloadConfig(cmd *cobra.Command) {
+	running := cfg
+	err := loadConfig(cmd)
+	loaded := cfg
+	cfg = running
+	if err != nil {
+		slog.Error("config reload rejected", "error", err)
+		return
+	}
+
+	var applied, restart []string
+	for _, key := range running.Diff(loaded) {
+		if _, ok := reloaders[key]; ok {
+			applied = append(applied, key)
+		} else {
+			restart = append(restart, key)
+		}
+	}
+	for _, key := range applied {
+		if err := reloaders[key](loaded); err != nil {
+			slog.Error("failed to apply setting", "setting", key, "error", err)
+		}
+	}
+
+	// Certificates are renewed in place, so they are read again even when
+	// their paths are unchanged
+	if certs != nil {
+		if err := certs.Reload(); err != nil {
+			slog.Error("failed to reload TLS certificate", "error", err)
+		}
+	}
+
+	slog.Info("config reloaded", "changed", applied)
+	if len(restart) > 0 {
+		slog.Warn("config changes need a restart to take effect", "settings", restart)
+	}
+}
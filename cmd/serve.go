@@ -2,120 +2,413 @@ package cmd
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
 	"syscall"
 	"time"
 
 	"student-server/auth"
+	"student-server/cache"
 	"student-server/database"
+	"student-server/events"
+	"student-server/graph"
+	"student-server/grpcserver"
 	"student-server/handlers"
+	"student-server/logging"
+	"student-server/metrics"
+	"student-server/middleware"
+	"student-server/outbox"
+	"student-server/ratelimit"
+	"student-server/tlsconfig"
+	"student-server/tracing"
+	"student-server/webhooks"
 
 	"github.com/gorilla/mux"
 	"github.com/spf13/cobra"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
-var port int
-
 var serveCmd = &cobra.Command{
 	Use:   "serve",
 	Short: "Start the student REST API server",
-	Run: func(cmd *cobra.Command, args []string) {
-		startServer()
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(cmd); err != nil {
+			return err
+		}
+		startServer(cmd)
+		return nil
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(serveCmd)
-	serveCmd.Flags().IntVarP(&port, "port", "p", 8080, "Port to run the server on")
+	addServeFlags(serveCmd.Flags())
+	addDatabaseFlags(serveCmd)
 }
 
-func startServer() {
-	// dbHost := "localhost"
-	// dbUser := "mamun"
-	// dbPassword := "1234"
-	// dbName := "student_db"
-	// dbPort := "5432"
+func startServer(cmd *cobra.Command) {
+	if err := logging.Setup(os.Stderr, cfg.Logging); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	auth.SetUsers(cfg.Auth.Users)
+	auth.SetClientCertRules(cfg.Auth.ClientCerts)
+	if err := middleware.SetCORSPolicy(cfg.CORS); err != nil {
+		fatal("invalid CORS policy", "error", err)
+	}
+	if err := webhooks.SetConfig(cfg.Webhooks); err != nil {
+		fatal("invalid webhook settings", "error", err)
+	}
+	handlers.PrimaryReadWindow = cfg.Server.PrimaryReadWindow
+	handlers.MaxSubscriptionsPerConn = cfg.WebSocket.MaxSubscriptions
+	database.SlowQueryThreshold = cfg.Database.SlowQueryThreshold
 
-	// PostgreSQL connection string
-	// dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-	// 	dbHost, dbUser, dbPassword, dbName, dbPort)
+	if err := database.ConnectDB(cfg.Database.Config); err != nil {
+		fatal("failed to connect to the database", "error", err)
+	}
+	db := database.DB
+	slog.Info("connected to the database", "driver", db.Dialector.Name())
 
-	// // Connect to PostgreSQL using GORM
-	// db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	// if err != nil {
-	// 	log.Fatalf("❌ Failed to connect to database: %v", err)
-	// }
+	if cfg.Database.AutoMigrate {
+		applied, err := database.Migrate(db)
+		if err != nil {
+			fatal("failed to migrate database", "error", err)
+		}
+		for _, m := range applied {
+			slog.Info("applied migration", "version", m.Version, "name", m.Name)
+		}
+		slog.Info("database schema is up to date")
+	}
 
-	database.ConnectDB()
-	db := database.DB
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("failed to set up tracing", "error", err)
+	}
+	defer shutdownTracing(context.Background())
+	if cfg.Tracing.Exporter != tracing.ExporterNone {
+		slog.Info("exporting traces", "exporter", cfg.Tracing.Exporter)
+	}
 
-	// Drop and re-create the students table (if needed)
-	// This will drop the existing table and create a new one based on the current model
-	// if err := db.Migrator().DropTable(&models.Student{}); err != nil {
-	// 	log.Fatalf("❌ Failed to drop table: %v", err)
-	// }
-	// if err := db.AutoMigrate(&models.Student{}); err != nil {
-	// 	log.Fatalf("❌ Failed to migrate database: %v", err)
-	// }
-	log.Println("✅ Connected to PostgreSQL & migrated successfully!")
+	if err := metrics.InstrumentDB(db, "primary"); err != nil {
+		fatal("failed to instrument database", "error", err)
+	}
+	if err := tracing.InstrumentDB(db); err != nil {
+		fatal("failed to instrument database", "error", err)
+	}
 
 	// Set the database instance in handlers
 	handlers.SetDB(db)
+	if cfg.Cache.Enabled {
+		database.SetStudentCache(cache.NewLRU(cfg.Cache.MaxEntries, cfg.Cache.TTL))
+	}
 
-	// Read the PORT environment variable if set
-	portStr := os.Getenv("PORT")
-	if portStr != "" {
-		var err error
-		port, err = strconv.Atoi(portStr)
+	broker := events.NewBroker(cfg.Events.History)
+	handlers.SetEventBroker(broker)
+	dispatcher := webhooks.NewDispatcher(db)
+
+	// Student writes record their events in the outbox. Every instance
+	// tails it to feed its own event stream subscribers, while the relay
+	// hands each event once, cluster-wide, to the webhook queue and any
+	// external sinks.
+	// Events keep their outbox IDs, so a client can resume on any instance,
+	// and from the outbox itself once the broker's history has moved on.
+	broker.Backlog = outbox.Backlog(db)
+	tailer := outbox.NewTailer(db, func(_ context.Context, msg outbox.Message) {
+		broker.Add(msg.Event())
+	})
+	database.OnCommit(tailer.Wake)
+	var sinks []outbox.Sink
+	if cfg.Features.Webhooks {
+		sinks = append(sinks, outbox.FuncSink{SinkName: "webhooks", Fn: func(ctx context.Context, msg outbox.Message) error {
+			return dispatcher.Enqueue(ctx, msg.Type, msg.Student)
+		}})
+	}
+	if cfg.Events.OutboxLog {
+		sinks = append(sinks, outbox.LogSink{})
+	}
+	if cfg.Events.NATSURL != "" {
+		natsSink := outbox.NewNATSSink(cfg.Events.NATSURL, cfg.Events.NATSSubjectPrefix)
+		defer natsSink.Close()
+		sinks = append(sinks, natsSink)
+	}
+	relay := outbox.NewRelay(db, sinks...)
+	database.OnCommit(relay.Wake)
+
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go relay.Run(workerCtx)
+	go tailer.Run(workerCtx)
+	if cfg.Features.Webhooks {
+		go dispatcher.Run(workerCtx)
+	}
+
+	var cluster *database.Cluster
+	if len(cfg.Database.Replicas) > 0 {
+		cluster, err = database.OpenCluster(db, cfg.Database.Config)
+		if err != nil {
+			fatal("failed to set up read replicas", "error", err)
+		}
+		for _, replica := range cluster.Replicas {
+			if err := metrics.InstrumentDB(replica.DB, replica.Name); err != nil {
+				fatal("failed to instrument database", "replica", replica.Name, "error", err)
+			}
+			if err := tracing.InstrumentDB(replica.DB); err != nil {
+				fatal("failed to instrument database", "replica", replica.Name, "error", err)
+			}
+		}
+		handlers.SetReadReplicas(cluster)
+		// Replicas may lag behind the primary for a while after a write
+		database.CacheSettleTime = cfg.Server.PrimaryReadWindow
+		go cluster.Run(workerCtx)
+	}
+
+	// Requests mux can't route skip router middleware, so the same chain
+	// wraps the not found and method not allowed responses
+	chain := []mux.MiddlewareFunc{tracing.Middleware, middleware.RequestID, metrics.Middleware, middleware.AccessLog,
+		middleware.CORS, middleware.MaxBodySize(cfg.Server.MaxBodyBytes)}
+	if cfg.Compression.Enabled {
+		chain = append(chain, middleware.Compress(cfg.Compression.MinBytes))
+	}
+
+	var tlsConfig *tls.Config
+	if cfg.TLS.Enabled() {
+		certs, err = tlsconfig.NewCertReloader(cfg.TLS.Cert, cfg.TLS.Key)
 		if err != nil {
-			log.Fatalf("Invalid port value: %v", err)
+			fatal("failed to load TLS certificate", "error", err)
+		}
+		if tlsConfig, err = tlsconfig.ServerConfig(cfg.TLS, certs); err != nil {
+			fatal("invalid TLS settings", "error", err)
+		}
+		if cfg.TLS.ReloadInterval > 0 {
+			go certs.Watch(workerCtx, cfg.TLS.ReloadInterval)
+		}
+		if cfg.TLS.HSTSMaxAge > 0 {
+			chain = append(chain, middleware.HSTS(cfg.TLS.HSTSMaxAge))
 		}
+		slog.Info("serving TLS", "certificate", cfg.TLS.Cert, "expires", certs.Certificate().NotAfter)
+	}
+	if limiter, err = ratelimit.New(cfg.RateLimit, ratelimit.NewMemoryStore()); err != nil {
+		fatal("invalid rate limits", "error", err)
+	}
+	grpcserver.SetRateLimiter(limiter)
+	// Addresses are limited before authentication, so failed attempts
+	// count too; group limits count by principal, so they apply after it
+	limited := func(group string, next http.Handler) http.Handler {
+		return limiter.Middleware(ratelimit.GroupAuth)(auth.BasicAuthMiddleware(limiter.Middleware(group)(next)))
 	}
 
 	router := mux.NewRouter()
+	router.Use(chain...)
+	router.NotFoundHandler = middleware.Chain(http.NotFoundHandler(), chain...)
+	router.MethodNotAllowedHandler = middleware.Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}), chain...)
 
 	// Public route
 	router.HandleFunc("/", handlers.HomeHandler).Methods("GET")
+	router.HandleFunc("/healthz", handlers.HealthzHandler).Methods("GET")
+	router.HandleFunc("/readyz", handlers.ReadyzHandler).Methods("GET")
+	if cfg.Features.Metrics {
+		router.Handle("/metrics", metrics.Handler()).Methods("GET")
+	}
+
+	// Event streams are limited on their own, as each one stays open
+	if cfg.Features.Events {
+		router.Handle("/students/events", limited(ratelimit.GroupStreams, http.HandlerFunc(handlers.StudentEventsHandler))).Methods("GET")
+	}
 
 	// Protected routes (require authentication)
 	protectedRoutes := router.PathPrefix("/students").Subrouter()
-	protectedRoutes.Use(auth.BasicAuthMiddleware)
-	protectedRoutes.HandleFunc("", handlers.GetStudentsHandler).Methods("GET")
-	protectedRoutes.HandleFunc("", handlers.AddStudentHandler).Methods("POST")
-	protectedRoutes.HandleFunc("/{id}", handlers.GetStudentByIDHandler).Methods("GET")
-	protectedRoutes.HandleFunc("/{id}", handlers.UpdateStudentHandler).Methods("PUT")
-	protectedRoutes.HandleFunc("/{id}", handlers.DeleteStudentHandler).Methods("DELETE")
-
-	address := fmt.Sprintf("0.0.0.0:%d", port)
+	protectedRoutes.Use(limiter.Middleware(ratelimit.GroupAuth), auth.BasicAuthMiddleware, limiter.Middleware(ratelimit.GroupStudents))
+	protectedRoutes.HandleFunc("", handlers.WithQueryTimeout(cfg.Timeouts.List, handlers.GetStudentsHandler)).Methods("GET")
+	protectedRoutes.HandleFunc("", handlers.WithQueryTimeout(cfg.Timeouts.Write, handlers.AddStudentHandler)).Methods("POST")
+	protectedRoutes.HandleFunc("/{id}", handlers.WithQueryTimeout(cfg.Timeouts.Read, handlers.GetStudentByIDHandler)).Methods("GET")
+	protectedRoutes.HandleFunc("/{id}", handlers.WithQueryTimeout(cfg.Timeouts.Write, handlers.UpdateStudentHandler)).Methods("PUT")
+	protectedRoutes.HandleFunc("/{id}", handlers.WithQueryTimeout(cfg.Timeouts.Write, handlers.DeleteStudentHandler)).Methods("DELETE")
+
+	if cfg.Features.Webhooks {
+		webhookRoutes := router.PathPrefix("/webhooks").Subrouter()
+		webhookRoutes.Use(limiter.Middleware(ratelimit.GroupAuth), auth.BasicAuthMiddleware, limiter.Middleware(ratelimit.GroupWebhooks))
+		webhookRoutes.HandleFunc("", handlers.WithQueryTimeout(cfg.Timeouts.List, handlers.GetWebhooksHandler)).Methods("GET")
+		webhookRoutes.HandleFunc("", handlers.WithQueryTimeout(cfg.Timeouts.Write, handlers.CreateWebhookHandler)).Methods("POST")
+		webhookRoutes.HandleFunc("/{id}", handlers.WithQueryTimeout(cfg.Timeouts.Read, handlers.GetWebhookHandler)).Methods("GET")
+		webhookRoutes.HandleFunc("/{id}", handlers.WithQueryTimeout(cfg.Timeouts.Write, handlers.DeleteWebhookHandler)).Methods("DELETE")
+		webhookRoutes.HandleFunc("/{id}/deliveries", handlers.WithQueryTimeout(cfg.Timeouts.List, handlers.GetWebhookDeliveriesHandler)).Methods("GET")
+		webhookRoutes.HandleFunc("/{id}/deliveries/{deliveryID}", handlers.WithQueryTimeout(cfg.Timeouts.Read, handlers.GetWebhookDeliveryHandler)).Methods("GET")
+		webhookRoutes.HandleFunc("/{id}/deliveries/{deliveryID}/redeliver", handlers.WithQueryTimeout(cfg.Timeouts.Write, handlers.RedeliverWebhookHandler)).Methods("POST")
+	}
+
+	// WebSocket subscriptions authenticate on the upgrade request
+	if cfg.Features.WebSocket {
+		router.Handle("/ws", limited(ratelimit.GroupStreams, http.HandlerFunc(handlers.WebSocketHandler))).Methods("GET")
+	}
+
+	// GraphQL shares the data layer and authentication with the REST routes
+	if cfg.Features.GraphQL {
+		graphqlHandler, err := graph.NewHandler(db, cfg.GraphQL)
+		if err != nil {
+			fatal("failed to build GraphQL schema", "error", err)
+		}
+		router.Handle("/graphql", limited(ratelimit.GroupGraphQL, handlers.WithQueryTimeout(cfg.Timeouts.List, graphqlHandler.ServeHTTP))).Methods("GET", "POST")
+	}
+
+	var grpcOpts []grpc.ServerOption
+	if tlsConfig != nil && cfg.Server.GRPCPort > 0 {
+		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	grpcServer, grpcHealth := grpcserver.New(db, grpcOpts...)
+
+	var handler http.Handler = router
+	if cfg.Server.GRPCPort == 0 {
+		// Multiplex gRPC and HTTP on one port; gRPC needs HTTP/2, which
+		// TLS negotiates and h2c provides without it
+		handler = grpcserver.Multiplex(grpcServer, router)
+		if tlsConfig == nil {
+			handler = h2c.NewHandler(handler, &http2.Server{})
+		}
+	}
+
+	address := fmt.Sprintf("0.0.0.0:%d", cfg.Server.Port)
 	server := &http.Server{
-		Addr:    address,
-		Handler: router,
+		Addr:              address,
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	// Shutdown doesn't wait for event streams to end on their own
+	server.RegisterOnShutdown(handlers.CloseStreams)
+	if tlsConfig != nil {
+		if err := http2.ConfigureServer(server, &http2.Server{}); err != nil {
+			fatal("failed to enable HTTP/2", "error", err)
+		}
 	}
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
 
 	go func() {
-		log.Printf("🚀 Server running on port %d...\n", port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf(" ListenAndServe error: %v", err)
+		slog.Info("server running", "port", cfg.Server.Port, "tls", tlsConfig != nil)
+		var err error
+		if tlsConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			fatal("HTTP server failed", "error", err)
 		}
 	}()
 
-	<-stop
-	log.Println("⚠️  Shutting down server...")
+	// Plain HTTP only redirects, so basic auth credentials never travel
+	// unencrypted
+	var redirectServer *http.Server
+	if cfg.TLS.RedirectPort > 0 {
+		redirectServer = &http.Server{
+			Addr:              fmt.Sprintf("0.0.0.0:%d", cfg.TLS.RedirectPort),
+			Handler:           middleware.RedirectHTTPS(cfg.Server.Port),
+			ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+			IdleTimeout:       cfg.Server.IdleTimeout,
+		}
+		go func() {
+			slog.Info("redirecting HTTP to HTTPS", "port", cfg.TLS.RedirectPort)
+			if err := redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fatal("HTTP redirect server failed", "error", err)
+			}
+		}()
+	}
+
+	if cfg.Server.GRPCPort > 0 {
+		listener, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", cfg.Server.GRPCPort))
+		if err != nil {
+			fatal("failed to listen for gRPC", "error", err)
+		}
+		go func() {
+			slog.Info("gRPC server running", "port", cfg.Server.GRPCPort)
+			if err := grpcServer.Serve(listener); err != nil {
+				fatal("gRPC server failed", "error", err)
+			}
+		}()
+	}
+
+	// SIGHUP reloads the configuration until the server is told to stop
+	for running := true; running; {
+		select {
+		case <-reload:
+			slog.Info("reloading config")
+			reloadConfig(cmd)
+		case <-stop:
+			running = false
+		}
+	}
+	slog.Info("shutting down server")
 
-	// Graceful shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	// Fail readiness first and keep serving for a while, so load balancers
+	// take the server out of rotation before connections are refused
+	handlers.SetShuttingDown(true)
+	grpcHealth.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	if cfg.Server.DrainDelay > 0 {
+		slog.Info("draining", "delay", cfg.Server.DrainDelay)
+		time.Sleep(cfg.Server.DrainDelay)
+	}
+
+	// Stop accepting connections and give requests, streams and RPCs in
+	// flight until the shutdown timeout to finish; whatever is left after
+	// that is cut off
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server Shutdown Failed: %v", err)
+		slog.Warn("requests still running after the shutdown timeout, closing their connections", "error", err)
+		server.Close()
+	}
+	if redirectServer != nil {
+		redirectServer.Shutdown(ctx)
 	}
-	log.Println("✅ Server exited gracefully")
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+	select {
+	case <-grpcStopped:
+	case <-ctx.Done():
+		slog.Warn("RPCs still running after the shutdown timeout, cancelling them")
+		grpcServer.Stop()
+	}
+	if err := handlers.WaitForWebSockets(ctx); err != nil {
+		slog.Warn("WebSockets still open after the shutdown timeout", "error", err)
+	}
+
+	// Background work ends before the database connections it uses
+	stopWorkers()
+	if cluster != nil {
+		if err := cluster.Close(); err != nil {
+			slog.Warn("failed to close replica connections", "error", err)
+		}
+	}
+	if err := database.Close(db); err != nil {
+		slog.Warn("failed to close database connections", "error", err)
+	}
+	slog.Info("server exited gracefully")
+}
+
+// fatal logs msg at error level and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
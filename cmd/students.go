@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"student-server/client"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	clientURL      string
+	clientUser     string
+	clientPassword string
+	clientProfile  string
+	profilesPath   string
+	outputFormat   string
+
+	studentName  string
+	studentAge   int
+	studentGrade string
+)
+
+var studentsCmd = &cobra.Command{
+	Use:   "students",
+	Short: "Manage students on a running server",
+	Long: `Talk to a running student server over HTTP.
+
+Connection settings are taken from flags, then the STUDENT_SERVER_URL,
+STUDENT_SERVER_USER and STUDENT_SERVER_PASSWORD environment variables,
+then the selected profile in the profiles file.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if !client.ValidFormat(outputFormat) {
+			return fmt.Errorf("unknown output format %q (want table, json or yaml)", outputFormat)
+		}
+		return nil
+	},
+}
+
+var studentsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all students",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient(cmd)
+		if err != nil {
+			return err
+		}
+		students, err := c.ListStudents()
+		if err != nil {
+			return err
+		}
+		return client.PrintStudents(cmd.OutOrStdout(), outputFormat, students)
+	},
+}
+
+var studentsGetCmd = &cobra.Command{
+	Use:   "get <id>",
+	Short: "Show a student by ID",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient(cmd)
+		if err != nil {
+			return err
+		}
+		student, err := c.GetStudent(args[0])
+		if err != nil {
+			return err
+		}
+		return client.PrintStudent(cmd.OutOrStdout(), outputFormat, *student)
+	},
+}
+
+var studentsCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Add a new student",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient(cmd)
+		if err != nil {
+			return err
+		}
+		msg, err := c.CreateStudent(studentFields(cmd))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), msg)
+		return nil
+	},
+}
+
+var studentsUpdateCmd = &cobra.Command{
+	Use:   "update <id>",
+	Short: "Update a student's details",
+	Long:  "Update a student's details. Only the fields given as flags are changed.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fields := studentFields(cmd)
+		if len(fields) == 0 {
+			return fmt.Errorf("nothing to update: set at least one of --name, --age, --grade")
+		}
+		c, err := newClient(cmd)
+		if err != nil {
+			return err
+		}
+		msg, err := c.UpdateStudent(args[0], fields)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), msg)
+		return nil
+	},
+}
+
+var studentsDeleteCmd = &cobra.Command{
+	Use:   "delete <id>",
+	Short: "Delete a student by ID",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient(cmd)
+		if err != nil {
+			return err
+		}
+		msg, err := c.DeleteStudent(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), msg)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(studentsCmd)
+	studentsCmd.AddCommand(studentsListCmd, studentsGetCmd, studentsCreateCmd, studentsUpdateCmd, studentsDeleteCmd)
+
+	flags := studentsCmd.PersistentFlags()
+	flags.StringVar(&clientURL, "url", "", "Base URL of the server (default http://localhost:8080)")
+	flags.StringVarP(&clientUser, "user", "u", "", "Username for basic authentication")
+	flags.StringVar(&clientPassword, "password", "", "Password for basic authentication")
+	flags.StringVar(&clientProfile, "profile", os.Getenv("STUDENT_SERVER_PROFILE"), "Profile to use from the profiles file")
+	flags.StringVar(&profilesPath, "profiles-file", client.DefaultProfilesPath(), "Path to the profiles file")
+	flags.StringVarP(&outputFormat, "output", "o", client.FormatTable, "Output format: table, json or yaml")
+
+	for _, c := range []*cobra.Command{studentsCreateCmd, studentsUpdateCmd} {
+		c.Flags().StringVar(&studentName, "name", "", "Student name")
+		c.Flags().IntVar(&studentAge, "age", 0, "Student age")
+		c.Flags().StringVar(&studentGrade, "grade", "", "Student grade")
+	}
+	studentsCreateCmd.MarkFlagRequired("name")
+	studentsCreateCmd.MarkFlagRequired("age")
+	studentsCreateCmd.MarkFlagRequired("grade")
+}
+
+// newClient resolves connection settings with flags taking precedence
+// over environment variables, and environment over the profile
+func newClient(cmd *cobra.Command) (*client.Client, error) {
+	profile, err := client.LoadProfile(profilesPath, clientProfile)
+	if err != nil {
+		return nil, err
+	}
+
+	url := pick(cmd, "url", clientURL, "STUDENT_SERVER_URL", profile.URL)
+	if url == "" {
+		url = "http://localhost:8080"
+	}
+	user := pick(cmd, "user", clientUser, "STUDENT_SERVER_USER", profile.Username)
+	password := pick(cmd, "password", clientPassword, "STUDENT_SERVER_PASSWORD", profile.Password)
+
+	return client.New(url, user, password), nil
+}
+
+func pick(cmd *cobra.Command, flag, flagValue, envKey, profileValue string) string {
+	if cmd.Flags().Changed(flag) {
+		return flagValue
+	}
+	if v := os.Getenv(envKey); v != "" {
+		return v
+	}
+	return profileValue
+}
+
+// studentFields collects the student fields that were set on the command line
+func studentFields(cmd *cobra.Command) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if cmd.Flags().Changed("name") {
+		fields["name"] = studentName
+	}
+	if cmd.Flags().Changed("age") {
+		fields["age"] = studentAge
+	}
+	if cmd.Flags().Changed("grade") {
+		fields["grade"] = studentGrade
+	}
+	return fields
+}
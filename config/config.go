@@ -0,0 +1,379 @@
+// Package config defines the server's settings and loads them in layers:
+// built-in defaults, then a YAML or TOML file, then environment variables.
+// Command-line flags, applied by the cmd package, override all of them.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"student-server/auth"
+	"student-server/database"
+	"student-server/graph"
+	"student-server/handlers"
+	"student-server/logging"
+	"student-server/middleware"
+	"student-server/ratelimit"
+	"student-server/tlsconfig"
+	"student-server/tracing"
+	"student-server/webhooks"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting of the server
+type Config struct {
+	Server      Server                 `yaml:"server" toml:"server"`
+	TLS         tlsconfig.Config       `yaml:"tls" toml:"tls"`
+	Database    Database               `yaml:"database" toml:"database"`
+	Auth        Auth                   `yaml:"auth" toml:"auth"`
+	RateLimit   ratelimit.Config       `yaml:"rate_limit" toml:"rate_limit"`
+	CORS        middleware.CORSConfig  `yaml:"cors" toml:"cors"`
+	Compression Compression            `yaml:"compression" toml:"compression"`
+	Cache       Cache                  `yaml:"cache" toml:"cache"`
+	Logging     logging.Config         `yaml:"logging" toml:"logging"`
+	Timeouts    handlers.QueryTimeouts `yaml:"timeouts" toml:"timeouts"`
+	Tracing     tracing.Config         `yaml:"tracing" toml:"tracing"`
+	GraphQL     graph.Limits           `yaml:"graphql" toml:"graphql"`
+	Events      Events                 `yaml:"events" toml:"events"`
+	WebSocket   WebSocket              `yaml:"websocket" toml:"websocket"`
+	Webhooks    webhooks.Config        `yaml:"webhooks" toml:"webhooks"`
+	Features    Features               `yaml:"features" toml:"features"`
+}
+
+// Server holds the listener, request and shutdown settings
+type Server struct {
+	Port              int           `yaml:"port" toml:"port"`
+	GRPCPort          int           `yaml:"grpc_port" toml:"grpc_port"` // 0 shares the HTTP port, -1 disables gRPC
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout"`   // whole request, body included
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout"` // event streams are exempt
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`   // keep-alive connections between requests
+	MaxBodyBytes      int64         `yaml:"max_body_bytes" toml:"max_body_bytes"`
+	DrainDelay        time.Duration `yaml:"drain_delay" toml:"drain_delay"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"` // how long requests in flight may finish
+	PrimaryReadWindow time.Duration `yaml:"primary_read_window" toml:"primary_read_window"`
+}
+
+// Database holds the connection settings and how the schema is managed
+type Database struct {
+	database.Config    `yaml:",inline"`
+	AutoMigrate        bool          `yaml:"auto_migrate" toml:"auto_migrate"`
+	SlowQueryThreshold time.Duration `yaml:"slow_query_threshold" toml:"slow_query_threshold"`
+}
+
+// Auth lists the accounts accepted by basic authentication
+type Auth struct {
+	Users       map[string]string     `yaml:"users" toml:"users"` // username -> password
+	ClientCerts []auth.ClientCertRule `yaml:"client_certs" toml:"client_certs"`
+}
+
+// Events configures the change feed and where events are published
+type Events struct {
+	History           int    `yaml:"history" toml:"history"` // events kept for resuming streams
+	OutboxLog         bool   `yaml:"outbox_log" toml:"outbox_log"`
+	NATSURL           string `yaml:"nats_url" toml:"nats_url"`
+	NATSSubjectPrefix string `yaml:"nats_subject_prefix" toml:"nats_subject_prefix"`
+}
+
+// WebSocket configures /ws
+type WebSocket struct {
+	MaxSubscriptions int `yaml:"max_subscriptions" toml:"max_subscriptions"`
+}
+
+// Compression configures response compression
+type Compression struct {
+	Enabled  bool `yaml:"enabled" toml:"enabled"`
+	MinBytes int  `yaml:"min_bytes" toml:"min_bytes"` // smaller responses are sent as they are
+}
+
+// Cache configures the cache in front of student reads. Each instance has
+// its own cache and a write only invalidates the cache of the instance that
+// made it; other instances serve their copies until TTL runs out.
+type Cache struct {
+	Enabled    bool          `yaml:"enabled" toml:"enabled"`
+	MaxEntries int           `yaml:"max_entries" toml:"max_entries"`
+	TTL        time.Duration `yaml:"ttl" toml:"ttl"` // how stale a cached read may be after another instance's write
+}
+
+// Features turn optional parts of the API on and off
+type Features struct {
+	GraphQL   bool `yaml:"graphql" toml:"graphql"`
+	WebSocket bool `yaml:"websocket" toml:"websocket"`
+	Events    bool `yaml:"events" toml:"events"` // the /students/events stream
+	Webhooks  bool `yaml:"webhooks" toml:"webhooks"`
+	Metrics   bool `yaml:"metrics" toml:"metrics"`
+}
+
+// Default returns the built-in settings
+func Default() Config {
+	return Config{
+		Server: Server{
+			Port:              8080,
+			GRPCPort:          50051,
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			MaxBodyBytes:      1 << 20,
+			DrainDelay:        5 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+			PrimaryReadWindow: 5 * time.Second,
+		},
+		TLS: tlsconfig.DefaultConfig(),
+		Database: Database{
+			Config:             database.DefaultConfig(),
+			AutoMigrate:        true,
+			SlowQueryThreshold: 200 * time.Millisecond,
+		},
+		Auth:        Auth{Users: maps.Clone(auth.DefaultUsers)},
+		RateLimit:   ratelimit.DefaultConfig(),
+		CORS:        middleware.DefaultCORSConfig(),
+		Compression: Compression{Enabled: true, MinBytes: 1024},
+		Cache:       Cache{Enabled: true, MaxEntries: 10000, TTL: 30 * time.Second},
+		Logging:     logging.DefaultConfig(),
+		Timeouts:    handlers.DefaultQueryTimeouts,
+		Tracing:     tracing.DefaultConfig(),
+		GraphQL:     graph.DefaultLimits,
+		Events:      Events{History: 1000, NATSSubjectPrefix: "students"},
+		WebSocket:   WebSocket{MaxSubscriptions: 20},
+		Features:    Features{GraphQL: true, WebSocket: true, Events: true, Webhooks: true, Metrics: true},
+	}
+}
+
+// FileEnv names the environment variable that points at the config file
+const FileEnv = "STUDENT_SERVER_CONFIG"
+
+// DefaultFiles are tried in order when no config file is named
+var DefaultFiles = []string{"student-server.yaml", "student-server.yml", "student-server.toml"}
+
+// FindFile returns the config file to load: path if given, else the file
+// named by STUDENT_SERVER_CONFIG, else the first of DefaultFiles that
+// exists. An empty result means no file is used.
+func FindFile(path string) string {
+	if path != "" {
+		return path
+	}
+	if path = os.Getenv(FileEnv); path != "" {
+		return path
+	}
+	for _, name := range DefaultFiles {
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// LoadFile reads the YAML or TOML file at path (chosen by its extension)
+// into cfg. Settings the file leaves out keep their current value; unknown
+// settings are an error so typos don't go unnoticed.
+func LoadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// A file that lists users replaces the default ones rather than adding to them
+	users := cfg.Auth.Users
+	cfg.Auth.Users = nil
+	defer func() {
+		if cfg.Auth.Users == nil {
+			cfg.Auth.Users = users
+		}
+	}()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("%s: unknown setting %q", path, undecoded[0].String())
+		}
+	default:
+		return fmt.Errorf("%s: unsupported config format (want .yaml, .yml or .toml)", path)
+	}
+	return nil
+}
+
+// ApplyEnv overrides cfg with the environment variables that predate the
+// config file: PORT, DATABASE_URL, DB_* and AUTH_USERS
+// ("alice:secret,bob:hunter2")
+func ApplyEnv(cfg *Config) error {
+	if port := os.Getenv("PORT"); port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil {
+			return fmt.Errorf("invalid PORT %q", port)
+		}
+		cfg.Server.Port = n
+	}
+	if err := cfg.Database.ApplyEnv(); err != nil {
+		return err
+	}
+	if users := os.Getenv("AUTH_USERS"); users != "" {
+		cfg.Auth.Users = map[string]string{}
+		for _, pair := range strings.Split(users, ",") {
+			username, password, ok := strings.Cut(strings.TrimSpace(pair), ":")
+			if !ok || username == "" {
+				return fmt.Errorf("invalid AUTH_USERS entry %q (want username:password)", pair)
+			}
+			cfg.Auth.Users[username] = password
+		}
+	}
+	return nil
+}
+
+// Validate reports settings that are out of range or can't work together
+func (c Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port < 65536, "server.port %d is not a valid port", c.Server.Port)
+	check(c.Server.GRPCPort >= -1 && c.Server.GRPCPort < 65536, "server.grpc_port %d is not a valid port", c.Server.GRPCPort)
+	check(c.Server.GRPCPort <= 0 || c.Server.GRPCPort != c.Server.Port, "server.grpc_port must differ from server.port (use 0 to share it)")
+	check(c.Server.ReadHeaderTimeout >= 0 && c.Server.ReadTimeout >= 0 && c.Server.WriteTimeout >= 0 && c.Server.IdleTimeout >= 0,
+		"server timeouts must not be negative")
+	check(c.Server.MaxBodyBytes >= 0, "server.max_body_bytes must not be negative")
+	check(c.Server.DrainDelay >= 0, "server.drain_delay must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	if err := c.TLS.Validate(); err != nil {
+		problems = append(problems, "tls: "+strings.ReplaceAll(err.Error(), "\n", "; "))
+	}
+	check(c.TLS.RedirectPort == 0 || c.TLS.RedirectPort != c.Server.Port && c.TLS.RedirectPort != c.Server.GRPCPort, "tls.redirect_port must differ from the server ports")
+	if err := c.Database.Validate(); err != nil {
+		problems = append(problems, "database: "+err.Error())
+	}
+	check(len(c.Auth.Users) > 0, "auth.users must list at least one user")
+	for username, password := range c.Auth.Users {
+		check(password != "", "auth.users: %s has an empty password", username)
+	}
+	for _, rule := range c.Auth.ClientCerts {
+		if err := rule.Validate(); err != nil {
+			problems = append(problems, "auth.client_certs: "+err.Error())
+		}
+	}
+	check(len(c.Auth.ClientCerts) == 0 || c.TLS.ClientAuth != tlsconfig.ClientAuthNone, "auth.client_certs needs tls.client_auth optional or require")
+	if err := c.RateLimit.Validate(); err != nil {
+		problems = append(problems, "rate_limit: "+strings.ReplaceAll(err.Error(), "\n", "; "))
+	}
+	if err := c.CORS.Validate(); err != nil {
+		problems = append(problems, "cors: "+strings.ReplaceAll(err.Error(), "\n", "; "))
+	}
+	if err := c.Webhooks.Validate(); err != nil {
+		problems = append(problems, "webhooks: "+err.Error())
+	}
+	if _, err := logging.New(io.Discard, c.Logging); err != nil {
+		problems = append(problems, "logging: "+err.Error())
+	}
+	check(c.Timeouts.Read >= 0 && c.Timeouts.List >= 0 && c.Timeouts.Write >= 0, "timeouts must not be negative")
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	default:
+		problems = append(problems, fmt.Sprintf("tracing.exporter %q is not none, stdout or otlp", c.Tracing.Exporter))
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+	check(c.GraphQL.MaxDepth >= 0 && c.GraphQL.MaxComplexity >= 0, "graphql limits must not be negative")
+	check(c.Events.History > 0, "events.history must be positive")
+	check(c.WebSocket.MaxSubscriptions > 0, "websocket.max_subscriptions must be positive")
+	check(c.Compression.MinBytes >= 0, "compression.min_bytes must not be negative")
+	check(!c.Cache.Enabled || c.Cache.MaxEntries > 0 && c.Cache.TTL > 0, "cache.max_entries and cache.ttl must be positive")
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// Diff lists the settings that differ between c and other by their file
+// keys, such as "logging.level"
+func (c Config) Diff(other Config) []string {
+	var keys []string
+	diff(reflect.ValueOf(c), reflect.ValueOf(other), "", &keys)
+	return keys
+}
+
+func diff(a, b reflect.Value, prefix string, keys *[]string) {
+	if a.Kind() != reflect.Struct {
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			*keys = append(*keys, prefix)
+		}
+		return
+	}
+	for i := 0; i < a.NumField(); i++ {
+		name, opts, _ := strings.Cut(a.Type().Field(i).Tag.Get("yaml"), ",")
+		key := prefix
+		if opts != "inline" {
+			key = strings.TrimPrefix(prefix+"."+name, ".")
+		}
+		diff(a.Field(i), b.Field(i), key, keys)
+	}
+}
+
+// Redacted returns a copy of c with passwords replaced, for printing
+func (c Config) Redacted() Config {
+	const hidden = "REDACTED"
+	if c.Database.Password != "" {
+		c.Database.Password = hidden
+	}
+	c.Database.URL = redactDSN(c.Database.URL)
+	users := make(map[string]string, len(c.Auth.Users))
+	for username := range c.Auth.Users {
+		users[username] = hidden
+	}
+	c.Auth.Users = users
+	c.Database.Replicas = append([]string(nil), c.Database.Replicas...)
+	for i, replica := range c.Database.Replicas {
+		c.Database.Replicas[i] = redactDSN(replica)
+	}
+	return c
+}
+
+// dsnPassword matches the password in a key/value DSN such as
+// "host=db password='s3 cret'"
+var dsnPassword = regexp.MustCompile(`(?i)(\bpassword\s*=\s*)('(?:[^'\\]|\\.)*'|\S*)`)
+
+// redactDSN hides the password in a database URL or key/value DSN
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return dsnPassword.ReplaceAllString(dsn, "${1}xxxxx")
+}
+
+// Marshal encodes c as YAML or TOML
+func (c Config) Marshal(format string) ([]byte, error) {
+	switch format {
+	case "yaml", "yml":
+		return yaml.Marshal(c)
+	case "toml":
+		var buf bytes.Buffer
+		err := toml.NewEncoder(&buf).Encode(c)
+		return buf.Bytes(), err
+	default:
+		return nil, fmt.Errorf("unknown format %q (want yaml or toml)", format)
+	}
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"student-server/cache"
+	"student-server/metrics"
+	"student-server/models"
+
+	"gorm.io/gorm"
+)
+
+// Cache keys; every list query is stored under studentsKeyPrefix
+const (
+	studentKeyPrefix  = "student:"
+	studentsKeyPrefix = "students:"
+)
+
+var (
+	studentCache cache.Cache
+
+	// CacheSettleTime is how long after a change reads may not refill the
+	// cache, so a replica that hasn't caught up yet can't put an old copy
+	// back. Without replicas it can stay 0.
+	CacheSettleTime time.Duration
+
+	changesMu sync.Mutex
+	changes   = map[string]time.Time{} // cache key or list prefix -> time of its last change
+)
+
+// SetStudentCache makes CachedStudent and CachedStudents read through c, or
+// straight from the database again when c is nil
+func SetStudentCache(c cache.Cache) {
+	studentCache = c
+}
+
+// CachedStudent is GetStudent through the student cache. Only use it for
+// reads: a student about to be changed must come from the database.
+func CachedStudent(ctx context.Context, db *gorm.DB, id uint) (*models.Student, error) {
+	key := studentKeyPrefix + strconv.FormatUint(uint64(id), 10)
+	return readThrough(ctx, "student", key, key, func() (*models.Student, error) {
+		return GetStudent(ctx, db, id)
+	})
+}
+
+// CachedStudents is ListStudents through the student cache
+func CachedStudents(ctx context.Context, db *gorm.DB, q StudentQuery) ([]models.Student, error) {
+	query, err := json.Marshal(q)
+	if err != nil {
+		return nil, err
+	}
+	return readThrough(ctx, "students", studentsKeyPrefix+string(query), studentsKeyPrefix, func() ([]models.Student, error) {
+		return ListStudents(ctx, db, q)
+	})
+}
+
+// readThrough returns the value cached under key, or loads and caches it.
+// changed is what writes invalidate the value by: the key itself, or the
+// prefix of all lists. A loaded value isn't cached if that changed while it
+// was loading or less than CacheSettleTime before.
+func readThrough[T any](ctx context.Context, name, key, changed string, load func() (T, error)) (T, error) {
+	c := studentCache
+	if c == nil {
+		return load()
+	}
+	if data, ok := c.Get(ctx, key); ok {
+		var value T
+		if err := json.Unmarshal(data, &value); err == nil {
+			metrics.CacheRequests.WithLabelValues(name, "hit").Inc()
+			return value, nil
+		}
+	}
+	metrics.CacheRequests.WithLabelValues(name, "miss").Inc()
+
+	started := time.Now()
+	value, err := load()
+	if err != nil || !settled(changed, started) {
+		return value, err
+	}
+	// Entries are stored encoded, so callers can't change them by
+	// changing what they were given
+	if data, err := json.Marshal(value); err == nil {
+		c.Set(ctx, key, data)
+	}
+	return value, nil
+}
+
+// settled reports whether a value of key loaded at started may be cached
+func settled(key string, started time.Time) bool {
+	changesMu.Lock()
+	defer changesMu.Unlock()
+	last, ok := changes[key]
+	return !ok || last.Before(started.Add(-CacheSettleTime))
+}
+
+// invalidateStudent drops the cached copies of a student and every cached
+// list, after a write has been committed. Only this process's cache is
+// cleared; other instances catch up when their entries expire.
+func invalidateStudent(ctx context.Context, id uint) {
+	c := studentCache
+	if c == nil {
+		return
+	}
+	key := studentKeyPrefix + strconv.FormatUint(uint64(id), 10)
+
+	now := time.Now()
+	changesMu.Lock()
+	changes[key], changes[studentsKeyPrefix] = now, now
+	// Changes that have settled no longer hold anything back
+	for k, t := range changes {
+		if now.Sub(t) > CacheSettleTime+time.Minute {
+			delete(changes, k)
+		}
+	}
+	changesMu.Unlock()
+
+	c.Delete(ctx, key)
+	c.DeletePrefix(ctx, studentsKeyPrefix)
+}
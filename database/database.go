@@ -2,27 +2,321 @@ package database
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
-	"student-server/models"
+	"strconv"
+	"strings"
+	"time"
 
+	"student-server/logging"
+
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
 var DB *gorm.DB
 
-func ConnectDB() {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		os.Getenv("DB_HOST"), os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_NAME"), os.Getenv("DB_PORT"))
+// SlowQueryThreshold is how long a statement may take before it is logged
+// as slow
+var SlowQueryThreshold = 200 * time.Millisecond
+
+// Supported database drivers
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite" // pure Go, no cgo
+)
+
+// Config describes how to connect to the database
+type Config struct {
+	Driver string `yaml:"driver" toml:"driver"` // DriverPostgres or DriverSQLite
+
+	// Path is the SQLite database file, or ":memory:"
+	Path string `yaml:"path" toml:"path"`
+
+	// URL is a complete Postgres connection string, either a postgres:// URL or a
+	// "key=value" DSN. When set, the individual connection fields and TLS
+	// settings are ignored.
+	URL string `yaml:"url" toml:"url"`
+
+	Host     string `yaml:"host" toml:"host"`
+	Port     string `yaml:"port" toml:"port"`
+	User     string `yaml:"user" toml:"user"`
+	Password string `yaml:"password" toml:"password"`
+	Name     string `yaml:"name" toml:"name"`
+
+	// SSLMode is one of disable, allow, prefer, require, verify-ca or verify-full
+	SSLMode     string `yaml:"sslmode" toml:"sslmode"`
+	SSLRootCert string `yaml:"sslrootcert" toml:"sslrootcert"` // CA certificate used by verify-ca and verify-full
+	SSLCert     string `yaml:"sslcert" toml:"sslcert"`         // client certificate
+	SSLKey      string `yaml:"sslkey" toml:"sslkey"`           // client key
+
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns"` // 0 means unlimited
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"` // 0 means connections are reused forever
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time"`
+
+	// Replicas are connection strings of read replicas of a Postgres primary
+	Replicas             []string      `yaml:"replicas" toml:"replicas"`
+	ReplicaCheckInterval time.Duration `yaml:"replica_check_interval" toml:"replica_check_interval"`
+
+	// ConnectTimeout is how long Open keeps retrying while the database is
+	// unreachable; 0 means a single attempt
+	ConnectTimeout time.Duration `yaml:"connect_timeout" toml:"connect_timeout"`
+	RetryBackoff   time.Duration `yaml:"retry_backoff" toml:"retry_backoff"` // delay after the first failed attempt, doubled each time
+	MaxBackoff     time.Duration `yaml:"max_backoff" toml:"max_backoff"`
+}
+
+// DefaultConfig returns the connection defaults, which match a local
+// Postgres without TLS
+func DefaultConfig() Config {
+	return Config{
+		Driver:               DriverPostgres,
+		Path:                 "student.db",
+		Host:                 "localhost",
+		Port:                 "5432",
+		SSLMode:              "disable",
+		MaxOpenConns:         25,
+		MaxIdleConns:         5,
+		ConnMaxLifetime:      30 * time.Minute,
+		ConnMaxIdleTime:      5 * time.Minute,
+		ConnectTimeout:       time.Minute,
+		ReplicaCheckInterval: 5 * time.Second,
+		RetryBackoff:         500 * time.Millisecond,
+		MaxBackoff:           10 * time.Second,
+	}
+}
+
+// ConfigFromEnv starts from DefaultConfig and applies the DATABASE_URL and
+// DB_* environment variables
+func ConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig()
+	if err := cfg.ApplyEnv(); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// ApplyEnv overrides the settings given in the DATABASE_URL and DB_*
+// environment variables
+func (cfg *Config) ApplyEnv() error {
+	if url := os.Getenv("DATABASE_URL"); url != "" {
+		cfg.URL = url
+	}
+	if replicas := os.Getenv("DB_REPLICAS"); replicas != "" {
+		cfg.Replicas = nil
+		for _, replica := range strings.Split(replicas, ",") {
+			if replica = strings.TrimSpace(replica); replica != "" {
+				cfg.Replicas = append(cfg.Replicas, replica)
+			}
+		}
+	}
+
+	text := map[string]*string{
+		"DB_DRIVER":      &cfg.Driver,
+		"DB_PATH":        &cfg.Path,
+		"DB_HOST":        &cfg.Host,
+		"DB_PORT":        &cfg.Port,
+		"DB_USER":        &cfg.User,
+		"DB_PASSWORD":    &cfg.Password,
+		"DB_NAME":        &cfg.Name,
+		"DB_SSLMODE":     &cfg.SSLMode,
+		"DB_SSLROOTCERT": &cfg.SSLRootCert,
+		"DB_SSLCERT":     &cfg.SSLCert,
+		"DB_SSLKEY":      &cfg.SSLKey,
+	}
+	for name, field := range text {
+		if value := os.Getenv(name); value != "" {
+			*field = value
+		}
+	}
+
+	ints := map[string]*int{
+		"DB_MAX_OPEN_CONNS": &cfg.MaxOpenConns,
+		"DB_MAX_IDLE_CONNS": &cfg.MaxIdleConns,
+	}
+	for name, field := range ints {
+		if value := os.Getenv(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid %s %q", name, value)
+			}
+			*field = n
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"DB_CONN_MAX_LIFETIME":      &cfg.ConnMaxLifetime,
+		"DB_CONN_MAX_IDLE_TIME":     &cfg.ConnMaxIdleTime,
+		"DB_CONNECT_TIMEOUT":        &cfg.ConnectTimeout,
+		"DB_REPLICA_CHECK_INTERVAL": &cfg.ReplicaCheckInterval,
+	}
+	for name, field := range durations {
+		if value := os.Getenv(name); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				return fmt.Errorf("invalid %s %q (want a duration such as 30s)", name, value)
+			}
+			*field = d
+		}
+	}
+
+	return nil
+}
+
+// Validate reports settings that can't work together
+func (c Config) Validate() error {
+	switch c.Driver {
+	case DriverPostgres:
+	case DriverSQLite:
+		if c.Path == "" {
+			return fmt.Errorf("the sqlite driver needs a database file")
+		}
+		if len(c.Replicas) > 0 {
+			return fmt.Errorf("read replicas are only supported with postgres")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown database driver %q (want postgres or sqlite)", c.Driver)
+	}
+
+	if c.URL != "" {
+		return nil
+	}
+	switch c.SSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		return fmt.Errorf("invalid SSL mode %q", c.SSLMode)
+	}
+	if (c.SSLCert == "") != (c.SSLKey == "") {
+		return fmt.Errorf("a client certificate needs both a certificate and a key")
+	}
+	return nil
+}
+
+// ConnString returns the connection string passed to the driver
+func (c Config) ConnString() string {
+	if c.Driver == DriverSQLite {
+		// WAL lets readers work alongside a writer, the busy timeout makes
+		// writers queue instead of failing, and taking the write lock when
+		// a transaction starts avoids upgrade deadlocks between them
+		return c.Path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_txlock=immediate"
+	}
+	if c.URL != "" {
+		return c.URL
+	}
+
+	params := [][2]string{
+		{"host", c.Host},
+		{"port", c.Port},
+		{"user", c.User},
+		{"password", c.Password},
+		{"dbname", c.Name},
+		{"sslmode", c.SSLMode},
+		{"sslrootcert", c.SSLRootCert},
+		{"sslcert", c.SSLCert},
+		{"sslkey", c.SSLKey},
+	}
+	var parts []string
+	for _, p := range params {
+		if p[1] != "" {
+			parts = append(parts, p[0]+"="+quoteDSNValue(p[1]))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteDSNValue quotes a value for a "key=value" connection string when it
+// contains spaces, quotes or backslashes
+func quoteDSNValue(v string) string {
+	if !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+// Open connects to the database described by cfg, retrying with
+// exponential backoff until cfg.ConnectTimeout has passed, and applies the
+// pool settings
+func Open(cfg Config) (*gorm.DB, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(cfg.ConnectTimeout)
+	backoff := cfg.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		db, err := gorm.Open(cfg.dialector(), &gorm.Config{Logger: logging.NewGormLogger(SlowQueryThreshold)})
+		if err == nil {
+			return db, configurePool(db, cfg)
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 || backoff <= 0 {
+			return nil, fmt.Errorf("failed to connect to database after %d attempts: %w", attempt, err)
+		}
+
+		wait := min(backoff, remaining)
+		slog.Warn("database not ready, retrying", "attempt", attempt, "error", err, "retry_in", wait)
+		time.Sleep(wait)
+		backoff *= 2
+		if cfg.MaxBackoff > 0 && backoff > cfg.MaxBackoff {
+			backoff = cfg.MaxBackoff
+		}
+	}
+}
+
+func (c Config) dialector() gorm.Dialector {
+	if c.Driver == DriverSQLite {
+		return sqlite.Open(c.ConnString())
+	}
+	return postgres.Open(c.ConnString())
+}
+
+// inMemory reports whether cfg names an in-memory SQLite database
+func (c Config) inMemory() bool {
+	return c.Driver == DriverSQLite && (c.Path == ":memory:" || strings.HasPrefix(c.Path, "file::memory:") || strings.Contains(c.Path, "mode=memory"))
+}
+
+func configurePool(db *gorm.DB, cfg Config) error {
+	sqlDB, err := db.DB()
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		return err
 	}
+	if cfg.inMemory() {
+		// Every connection to ":memory:" gets its own empty database, and
+		// the database goes away with the connection, so the one connection
+		// must stay open for good
+		cfg.MaxOpenConns = 1
+		cfg.MaxIdleConns = 1
+		cfg.ConnMaxLifetime = 0
+		cfg.ConnMaxIdleTime = 0
+	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	return nil
+}
 
-	DB = db
-	fmt.Println("Database connection established")
-	db.AutoMigrate(&models.Student{})
+// Close closes the connection pool of db
+func Close(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
 
+// ConnectDB connects using cfg and sets DB
+func ConnectDB(cfg Config) error {
+	db, err := Open(cfg)
+	if err != nil {
+		return err
+	}
+
+	DB = db
+	slog.Debug("database connection established", "driver", cfg.Driver)
+	return nil
 }
@@ -0,0 +1,335 @@
+package database
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// The SQL migrations compiled into the binary, in one directory per
+// database dialect. Every dialect has the same versions and names.
+//
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the Postgres advisory lock key held while migrating,
+// so replicas starting together apply each migration once
+const migrationLockID = 72616201
+
+// migrationFile matches "<version>_<name>.up.sql" and "<version>_<name>.down.sql"
+var migrationFile = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+var migrationName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string // empty when the migration can't be rolled back
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// schemaMigration is a row of the schema_migrations table
+type schemaMigration struct {
+	Version   int64
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrator applies and rolls back migrations, recording them in the
+// schema_migrations table
+type Migrator struct {
+	DB         *gorm.DB
+	Migrations []Migration // sorted by version
+}
+
+// NewMigrator loads the migrations in fsys
+func NewMigrator(db *gorm.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, Migrations: migrations}, nil
+}
+
+// LoadMigrations reads the migration files at the root of fsys
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+		parts := migrationFile.FindStringSubmatch(entry.Name())
+		if parts == nil {
+			return nil, fmt.Errorf("migration %s: name must look like 0001_description.up.sql", entry.Name())
+		}
+		version, _ := strconv.ParseInt(parts[1], 10, 64)
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[2]}
+			byVersion[version] = m
+		} else if m.Name != parts[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, parts[2])
+		}
+		if parts[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrations returns the compiled-in migrations for dialect, e.g. "postgres"
+// or "sqlite"
+func Migrations(dialect string) (fs.FS, error) {
+	sub, err := fs.Sub(migrationFiles, "migrations/"+dialect)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fs.ReadDir(sub, "."); err != nil {
+		return nil, fmt.Errorf("no migrations for database dialect %q", dialect)
+	}
+	return sub, nil
+}
+
+// NewMigratorFor creates a migrator with the compiled-in migrations for db's dialect
+func NewMigratorFor(db *gorm.DB) (*Migrator, error) {
+	fsys, err := Migrations(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	return NewMigrator(db, fsys)
+}
+
+// Migrate applies every pending compiled-in migration
+func Migrate(db *gorm.DB) ([]Migration, error) {
+	m, err := NewMigratorFor(db)
+	if err != nil {
+		return nil, err
+	}
+	return m.Up()
+}
+
+// Up applies every pending migration in order and returns the ones applied
+func (m *Migrator) Up() ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(func(conn *gorm.DB) error {
+		done, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.Migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				// Without an advisory lock (SQLite) another process may have
+				// got here first; transactions are serialised, so check again
+				var count int64
+				if err := tx.Model(&schemaMigration{}).Where("version = ?", migration.Version).Count(&count).Error; err != nil || count > 0 {
+					return err
+				}
+				if err := tx.Exec(migration.Up).Error; err != nil {
+					return err
+				}
+				return tx.Create(&schemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the most recently applied steps migrations and returns
+// the ones rolled back
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	var rolledBack []Migration
+	err := m.withLock(func(conn *gorm.DB) error {
+		var rows []schemaMigration
+		if err := conn.Order("version DESC").Limit(steps).Find(&rows).Error; err != nil {
+			return err
+		}
+		for _, row := range rows {
+			migration, ok := m.find(row.Version)
+			if !ok {
+				return fmt.Errorf("migration %04d_%s is applied but its files are missing", row.Version, row.Name)
+			}
+			if strings.TrimSpace(migration.Down) == "" {
+				return fmt.Errorf("migration %04d_%s cannot be rolled back", migration.Version, migration.Name)
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(migration.Down).Error; err != nil {
+					return err
+				}
+				return tx.Where("version = ?", migration.Version).Delete(&schemaMigration{}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("rolling back migration %04d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			rolledBack = append(rolledBack, migration)
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// Status lists every known migration and whether it has been applied
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	done := map[int64]time.Time{}
+	if m.DB.Migrator().HasTable(&schemaMigration{}) {
+		var err error
+		if done, err = appliedVersions(m.DB); err != nil {
+			return nil, err
+		}
+	}
+
+	status := make([]MigrationStatus, 0, len(m.Migrations))
+	for _, migration := range m.Migrations {
+		appliedAt, ok := done[migration.Version]
+		status = append(status, MigrationStatus{Migration: migration, Applied: ok, AppliedAt: appliedAt})
+	}
+	return status, nil
+}
+
+func (m *Migrator) find(version int64) (Migration, bool) {
+	for _, migration := range m.Migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
+
+// withLock runs fn on a single connection while holding the migration
+// lock, creating the schema_migrations table first if needed
+func (m *Migrator) withLock(fn func(conn *gorm.DB) error) error {
+	return m.DB.Connection(func(conn *gorm.DB) error {
+		if conn.Dialector.Name() == "postgres" {
+			// Session-level lock: released on unlock or when the connection closes
+			if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockID).Error; err != nil {
+				return fmt.Errorf("failed to acquire migration lock: %w", err)
+			}
+			defer conn.Exec("SELECT pg_advisory_unlock(?)", migrationLockID)
+		}
+
+		err := conn.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    BIGINT PRIMARY KEY,
+			name       VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		)`).Error
+		if err != nil {
+			return err
+		}
+		return fn(conn)
+	})
+}
+
+func appliedVersions(db *gorm.DB) (map[int64]time.Time, error) {
+	var rows []schemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	done := make(map[int64]time.Time, len(rows))
+	for _, row := range rows {
+		done[row.Version] = row.AppliedAt
+	}
+	return done, nil
+}
+
+// CreateMigration writes empty up and down scripts for a new migration,
+// numbered after the highest existing version, and returns their paths.
+// When dir holds one directory per dialect the scripts are created in each.
+func CreateMigration(dir, name string) ([]string, error) {
+	name = strings.ToLower(strings.Join(strings.Fields(name), "_"))
+	if !migrationName.MatchString(name) {
+		return nil, errors.New("migration name may only contain letters, digits and underscores")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs = append(dirs, filepath.Join(dir, entry.Name()))
+		}
+	}
+	if len(dirs) == 0 {
+		dirs = []string{dir}
+	}
+
+	version := int64(1)
+	for _, d := range dirs {
+		existing, err := LoadMigrations(os.DirFS(d))
+		if err != nil {
+			return nil, err
+		}
+		if len(existing) > 0 {
+			version = max(version, existing[len(existing)-1].Version+1)
+		}
+	}
+
+	var paths []string
+	for _, d := range dirs {
+		for _, direction := range []string{"up", "down"} {
+			file := filepath.Join(d, fmt.Sprintf("%04d_%s.%s.sql", version, name, direction))
+			f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+			if err != nil {
+				return paths, err
+			}
+			fmt.Fprintf(f, "-- %04d_%s (%s)\n", version, name, direction)
+			if err := f.Close(); err != nil {
+				return paths, err
+			}
+			paths = append(paths, file)
+		}
+	}
+	return paths, nil
+}
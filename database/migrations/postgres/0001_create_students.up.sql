@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS students (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    name       VARCHAR(100) NOT NULL,
+    age        BIGINT NOT NULL,
+    grade      VARCHAR(20) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_students_deleted_at ON students (deleted_at);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS outbox (
+    id           BIGSERIAL PRIMARY KEY,
+    event_type   VARCHAR(50) NOT NULL,
+    payload      TEXT NOT NULL,
+    created_at   TIMESTAMPTZ,
+    published_at TIMESTAMPTZ,
+    attempts     BIGINT NOT NULL DEFAULT 0,
+    last_error   TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_published_at ON outbox (published_at);
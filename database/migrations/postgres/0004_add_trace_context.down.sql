@@ -0,0 +1,2 @@
+ALTER TABLE webhook_deliveries DROP COLUMN trace_parent;
+ALTER TABLE outbox DROP COLUMN trace_parent;
@@ -0,0 +1,2 @@
+ALTER TABLE outbox ADD COLUMN trace_parent VARCHAR(55) NOT NULL DEFAULT '';
+ALTER TABLE webhook_deliveries ADD COLUMN trace_parent VARCHAR(55) NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS outbox_deliveries (
+    event_id     BIGINT NOT NULL,
+    sink         VARCHAR(50) NOT NULL,
+    attempts     BIGINT NOT NULL DEFAULT 0,
+    last_error   TEXT,
+    delivered_at TIMESTAMPTZ,
+    parked_at    TIMESTAMPTZ,
+    PRIMARY KEY (event_id, sink)
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_deliveries_parked_at ON outbox_deliveries (parked_at);
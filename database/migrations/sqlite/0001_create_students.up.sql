@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS students (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME,
+    updated_at DATETIME,
+    deleted_at DATETIME,
+    name       VARCHAR(100) NOT NULL,
+    age        INTEGER NOT NULL,
+    grade      VARCHAR(20) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_students_deleted_at ON students (deleted_at);
@@ -0,0 +1,41 @@
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at  DATETIME,
+    updated_at  DATETIME,
+    deleted_at  DATETIME,
+    url         VARCHAR(2048) NOT NULL,
+    event_types VARCHAR(255) NOT NULL,
+    secret      VARCHAR(255) NOT NULL,
+    active      NUMERIC NOT NULL DEFAULT true
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_subscriptions_deleted_at ON webhook_subscriptions (deleted_at);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    subscription_id INTEGER NOT NULL,
+    event_type      VARCHAR(50) NOT NULL,
+    payload         TEXT NOT NULL,
+    status          VARCHAR(20) NOT NULL,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME,
+    locked_until    DATETIME,
+    last_error      TEXT,
+    created_at      DATETIME,
+    updated_at      DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_subscription_id ON webhook_deliveries (subscription_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status ON webhook_deliveries (status);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_next_attempt_at ON webhook_deliveries (next_attempt_at);
+
+CREATE TABLE IF NOT EXISTS webhook_attempts (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    delivery_id INTEGER NOT NULL,
+    status_code INTEGER,
+    error       TEXT,
+    duration_ms INTEGER,
+    created_at  DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_attempts_delivery_id ON webhook_attempts (delivery_id);
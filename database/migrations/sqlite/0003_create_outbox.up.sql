@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS outbox (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_type   VARCHAR(50) NOT NULL,
+    payload      TEXT NOT NULL,
+    created_at   DATETIME,
+    published_at DATETIME,
+    attempts     INTEGER NOT NULL DEFAULT 0,
+    last_error   TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_published_at ON outbox (published_at);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS outbox_deliveries (
+    event_id     INTEGER NOT NULL,
+    sink         VARCHAR(50) NOT NULL,
+    attempts     INTEGER NOT NULL DEFAULT 0,
+    last_error   TEXT,
+    delivered_at DATETIME,
+    parked_at    DATETIME,
+    PRIMARY KEY (event_id, sink)
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_deliveries_parked_at ON outbox_deliveries (parked_at);
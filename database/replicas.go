@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"student-server/logging"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// Cluster is the primary database plus read replicas. Reads are spread
+// round-robin over the replicas that passed their last health check and
+// fall back to the primary when none did.
+type Cluster struct {
+	Primary  *gorm.DB
+	Replicas []*Replica
+
+	CheckInterval time.Duration
+	CheckTimeout  time.Duration
+
+	next atomic.Uint64
+}
+
+// Replica is a read-only copy of the primary
+type Replica struct {
+	Name    string // used in logs
+	DB      *gorm.DB
+	healthy atomic.Bool
+}
+
+// Healthy reports whether the replica passed its last health check
+func (r *Replica) Healthy() bool {
+	return r.healthy.Load()
+}
+
+// NewCluster creates a cluster. Replicas start out unhealthy until
+// CheckReplicas has seen them answer.
+func NewCluster(primary *gorm.DB, replicas ...*gorm.DB) *Cluster {
+	c := &Cluster{Primary: primary, CheckInterval: 5 * time.Second, CheckTimeout: 2 * time.Second}
+	for i, db := range replicas {
+		c.Replicas = append(c.Replicas, &Replica{Name: fmt.Sprintf("replica %d", i+1), DB: db})
+	}
+	return c
+}
+
+// Reader returns the database to run a read on
+func (c *Cluster) Reader() *gorm.DB {
+	n := len(c.Replicas)
+	start := c.next.Add(1)
+	for i := 0; i < n; i++ {
+		replica := c.Replicas[(start+uint64(i))%uint64(n)]
+		if replica.Healthy() {
+			return replica.DB
+		}
+	}
+	return c.Primary
+}
+
+// CheckReplicas pings every replica and records which ones answered
+func (c *Cluster) CheckReplicas(ctx context.Context) {
+	for _, replica := range c.Replicas {
+		err := ping(ctx, replica.DB, c.CheckTimeout)
+		healthy := err == nil
+		if was := replica.healthy.Swap(healthy); was != healthy {
+			if healthy {
+				slog.Info("read replica is healthy", "replica", replica.Name)
+			} else {
+				slog.Warn("read replica is down, reading from the primary instead", "replica", replica.Name, "error", err)
+			}
+		}
+	}
+}
+
+// Run checks the replicas every CheckInterval until ctx is cancelled
+func (c *Cluster) Run(ctx context.Context) {
+	if len(c.Replicas) == 0 {
+		return
+	}
+	ticker := time.NewTicker(c.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.CheckReplicas(ctx)
+		}
+	}
+}
+
+func ping(ctx context.Context, db *gorm.DB, timeout time.Duration) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return sqlDB.PingContext(ctx)
+}
+
+// Close closes the connection pools of the replicas. The primary is left
+// open for its owner to close.
+func (c *Cluster) Close() error {
+	var errs []error
+	for _, replica := range c.Replicas {
+		errs = append(errs, Close(replica.DB))
+	}
+	return errors.Join(errs...)
+}
+
+// OpenCluster builds a cluster around primary from the replicas in cfg and
+// checks them once. Replicas that are down are not an error; they are
+// used once a later health check finds them up.
+func OpenCluster(primary *gorm.DB, cfg Config) (*Cluster, error) {
+	var replicas []*gorm.DB
+	for _, url := range cfg.Replicas {
+		db, err := gorm.Open(postgres.Open(url), &gorm.Config{
+			DisableAutomaticPing: true,
+			Logger:               logging.NewGormLogger(SlowQueryThreshold),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := configurePool(db, cfg); err != nil {
+			return nil, err
+		}
+		replicas = append(replicas, db)
+	}
+
+	cluster := NewCluster(primary, replicas...)
+	if cfg.ReplicaCheckInterval > 0 {
+		cluster.CheckInterval = cfg.ReplicaCheckInterval
+	}
+	cluster.CheckReplicas(context.Background())
+	return cluster, nil
+}
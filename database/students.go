@@ -0,0 +1,208 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"student-server/events"
+	"student-server/models"
+	"student-server/tracing"
+
+	"gorm.io/gorm"
+)
+
+// ErrStudentNotFound is returned when no student matches the given ID
+var ErrStudentNotFound = errors.New("student not found")
+
+// ChangePayload is the outbox payload describing a student change
+type ChangePayload struct {
+	Type    events.Type    `json:"type"`
+	Time    time.Time      `json:"time"`
+	Student models.Student `json:"student"`
+}
+
+var commitHooks []func()
+
+// OnCommit registers hook to run after every committed student write, so
+// the outbox relay can pick up new events without waiting for its next poll
+func OnCommit(hook func()) {
+	commitHooks = append(commitHooks, hook)
+}
+
+// writeWithEvent runs write and records the resulting change event in the
+// outbox within one transaction, so the two can never diverge
+func writeWithEvent(ctx context.Context, db *gorm.DB, t events.Type, student *models.Student, write func(tx *gorm.DB) error) error {
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := write(tx); err != nil {
+			return err
+		}
+
+		payload, err := json.Marshal(ChangePayload{Type: t, Time: time.Now().UTC(), Student: *student})
+		if err != nil {
+			return err
+		}
+		return tx.Create(&models.OutboxEvent{
+			EventType:   string(t),
+			Payload:     string(payload),
+			TraceParent: tracing.TraceParent(ctx),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	invalidateStudent(ctx, student.ID)
+	for _, hook := range commitHooks {
+		hook()
+	}
+	return nil
+}
+
+// StudentFilter narrows down the students returned by ListStudents.
+// Zero values are ignored.
+type StudentFilter struct {
+	Name   string // case-insensitive substring match
+	Grade  string
+	MinAge int
+	MaxAge int
+}
+
+// StudentQuery describes a filtered, sorted page of students
+type StudentQuery struct {
+	Filter StudentFilter
+	SortBy string // one of the keys in sortColumns, defaults to "id"
+	Desc   bool
+	After  *models.Student // if set, only students sorted after this one
+	Limit  int             // 0 means no limit
+}
+
+// sortColumns maps the sort keys callers may use to table columns
+var sortColumns = map[string]string{
+	"id":         "id",
+	"name":       "name",
+	"age":        "age",
+	"grade":      "grade",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+// ValidSortKey reports whether key can be used as StudentQuery.SortBy
+func ValidSortKey(key string) bool {
+	_, ok := sortColumns[key]
+	return ok || key == ""
+}
+
+func applyFilter(tx *gorm.DB, f StudentFilter) *gorm.DB {
+	if f.Name != "" {
+		tx = tx.Where("LOWER(name) LIKE ?", "%"+strings.ToLower(f.Name)+"%")
+	}
+	if f.Grade != "" {
+		tx = tx.Where("grade = ?", f.Grade)
+	}
+	if f.MinAge > 0 {
+		tx = tx.Where("age >= ?", f.MinAge)
+	}
+	if f.MaxAge > 0 {
+		tx = tx.Where("age <= ?", f.MaxAge)
+	}
+	return tx
+}
+
+// ListStudents returns the students matching q
+func ListStudents(ctx context.Context, db *gorm.DB, q StudentQuery) ([]models.Student, error) {
+	column, ok := sortColumns[q.SortBy]
+	if !ok {
+		column = "id"
+	}
+	order := column
+	if q.Desc {
+		order += " DESC"
+	}
+
+	tx := applyFilter(db.WithContext(ctx).Model(&models.Student{}), q.Filter).Order(order)
+	if column != "id" {
+		// Keep the order stable across pages when sort values tie
+		tx = tx.Order("id")
+	}
+	if q.After != nil {
+		tx = applyAfter(tx, column, q.Desc, q.After)
+	}
+	if q.Limit > 0 {
+		tx = tx.Limit(q.Limit)
+	}
+
+	students := []models.Student{}
+	if err := tx.Find(&students).Error; err != nil {
+		return nil, err
+	}
+	return students, nil
+}
+
+// applyAfter keeps the students that come after last when sorted by column,
+// ties being broken by ascending id as in ListStudents
+func applyAfter(tx *gorm.DB, column string, desc bool, last *models.Student) *gorm.DB {
+	cmp := ">"
+	if desc {
+		cmp = "<"
+	}
+	if column == "id" {
+		return tx.Where("id "+cmp+" ?", last.ID)
+	}
+	value := map[string]interface{}{
+		"name":       last.Name,
+		"age":        last.Age,
+		"grade":      last.Grade,
+		"created_at": last.CreatedAt,
+		"updated_at": last.UpdatedAt,
+	}[column]
+	return tx.Where("("+column+" "+cmp+" ? OR ("+column+" = ? AND id > ?))", value, value, last.ID)
+}
+
+// CountStudents returns how many students match f
+func CountStudents(ctx context.Context, db *gorm.DB, f StudentFilter) (int64, error) {
+	var count int64
+	err := applyFilter(db.WithContext(ctx).Model(&models.Student{}), f).Count(&count).Error
+	return count, err
+}
+
+// GetStudent looks up a student by ID
+func GetStudent(ctx context.Context, db *gorm.DB, id uint) (*models.Student, error) {
+	var student models.Student
+	if err := db.WithContext(ctx).First(&student, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrStudentNotFound
+		}
+		return nil, err
+	}
+	return &student, nil
+}
+
+// CreateStudent inserts a new student, filling in its ID and timestamps
+func CreateStudent(ctx context.Context, db *gorm.DB, student *models.Student) error {
+	if err := student.Validate(); err != nil {
+		return err
+	}
+	return writeWithEvent(ctx, db, events.StudentCreated, student, func(tx *gorm.DB) error {
+		return tx.Create(student).Error
+	})
+}
+
+// UpdateStudent saves all fields of an existing student
+func UpdateStudent(ctx context.Context, db *gorm.DB, student *models.Student) error {
+	if err := student.Validate(); err != nil {
+		return err
+	}
+	return writeWithEvent(ctx, db, events.StudentUpdated, student, func(tx *gorm.DB) error {
+		return tx.Save(student).Error
+	})
+}
+
+// DeleteStudent removes the given student
+func DeleteStudent(ctx context.Context, db *gorm.DB, student *models.Student) error {
+	return writeWithEvent(ctx, db, events.StudentDeleted, student, func(tx *gorm.DB) error {
+		return tx.Delete(student).Error
+	})
+}
@@ -0,0 +1,157 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"student-server/models"
+)
+
+// Type names a student lifecycle event
+type Type string
+
+const (
+	StudentCreated Type = "student.created"
+	StudentUpdated Type = "student.updated"
+	StudentDeleted Type = "student.deleted"
+)
+
+// Event describes a change to a student. IDs increase monotonically so
+// clients can resume from the last one they saw.
+type Event struct {
+	ID      uint64         `json:"id"`
+	Type    Type           `json:"type"`
+	Student models.Student `json:"student"`
+	Time    time.Time      `json:"time"`
+}
+
+// Subscription receives events published after it was created. If the
+// subscriber falls behind and its buffer fills up, the broker drops it and
+// closes C; the client is expected to resubscribe from its last event ID.
+type Subscription struct {
+	C <-chan Event
+	c chan Event
+}
+
+// Broker fans events out to subscribers and keeps a bounded history of
+// recent events for resuming clients
+type Broker struct {
+	// Backlog, if set, looks up up to limit events after an ID the history
+	// no longer reaches back to, such as from the outbox. complete is false
+	// when some of them can't be found any more.
+	Backlog func(ctx context.Context, after uint64, limit int) (backlog []Event, complete bool, err error)
+
+	mu      sync.Mutex
+	nextID  uint64
+	history []Event
+	size    int
+	subs    map[*Subscription]struct{}
+}
+
+// NewBroker creates a broker remembering the last historySize events
+func NewBroker(historySize int) *Broker {
+	return &Broker{
+		nextID: 1,
+		size:   historySize,
+		subs:   map[*Subscription]struct{}{},
+	}
+}
+
+// Publish records an event under the next free ID and delivers it to every
+// subscriber
+func (b *Broker) Publish(t Type, student models.Student) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	event := Event{ID: b.nextID, Type: t, Student: student, Time: time.Now().UTC()}
+	b.add(event)
+	return event
+}
+
+// Add records an event that already has its ID, such as its outbox row ID,
+// and delivers it to every subscriber. IDs from a shared source mean the
+// same events on every instance and across restarts.
+func (b *Broker) Add(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.add(event)
+}
+
+func (b *Broker) add(event Event) {
+	if event.ID >= b.nextID {
+		b.nextID = event.ID + 1
+	}
+
+	if b.size > 0 {
+		if len(b.history) == b.size {
+			b.history = append(b.history[:0], b.history[1:]...)
+		}
+		b.history = append(b.history, event)
+	}
+
+	for sub := range b.subs {
+		select {
+		case sub.c <- event:
+		default:
+			// Slow consumer: drop it rather than block every publisher
+			delete(b.subs, sub)
+			close(sub.c)
+		}
+	}
+}
+
+// Subscribe registers a new subscriber with room for buffer pending events.
+// Events after lastID that are still in the history are returned as
+// missed; complete is false when some events after lastID have already
+// been evicted and the client should refetch its state.
+func (b *Broker) Subscribe(lastID uint64, buffer int) (sub *Subscription, missed []Event, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	complete = true
+	if lastID > 0 {
+		oldest := b.nextID
+		for _, e := range b.history {
+			oldest = min(oldest, e.ID)
+		}
+		// An ID from the future was handed out by an earlier process
+		complete = lastID+1 >= oldest && lastID < b.nextID
+		for _, e := range b.history {
+			if e.ID > lastID {
+				missed = append(missed, e)
+			}
+		}
+	}
+
+	c := make(chan Event, buffer)
+	sub = &Subscription{C: c, c: c}
+	b.subs[sub] = struct{}{}
+	return sub, missed, complete
+}
+
+// Resume subscribes like Subscribe, but asks Backlog for the events after
+// lastID when the history doesn't reach back to it. On error the
+// subscription is still returned, as incomplete.
+func (b *Broker) Resume(ctx context.Context, lastID uint64, buffer int) (sub *Subscription, missed []Event, complete bool, err error) {
+	sub, missed, complete = b.Subscribe(lastID, buffer)
+	if complete || b.Backlog == nil {
+		return sub, missed, complete, nil
+	}
+	missed, complete, err = b.Backlog(ctx, lastID, b.size)
+	if err != nil || !complete {
+		return sub, nil, false, err
+	}
+	return sub, missed, true, nil
+}
+
+// Unsubscribe stops delivery to sub. It is safe to call more than once.
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.c)
+	}
+}
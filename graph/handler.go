@@ -0,0 +1,188 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"gorm.io/gorm"
+)
+
+// maxBatchSize caps how many operations one batched request may carry
+const maxBatchSize = 20
+
+// request is a single GraphQL operation as sent by clients
+type request struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// Handler serves GraphQL queries over HTTP
+type Handler struct {
+	schema graphql.Schema
+	limits Limits
+}
+
+// NewHandler creates a GraphQL handler backed by db
+func NewHandler(db *gorm.DB, limits Limits) (*Handler, error) {
+	schema, err := NewSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{schema: schema, limits: limits}, nil
+}
+
+// ServeHTTP accepts a single operation via GET query parameters or a POST
+// JSON body, or a batch of operations as a POST JSON array
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodGet {
+		req := request{
+			Query:         r.URL.Query().Get("query"),
+			OperationName: r.URL.Query().Get("operationName"),
+		}
+		if vars := r.URL.Query().Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid variables")
+				return
+			}
+		}
+		// Mutations must not be triggered by GET requests
+		h.respond(w, h.execute(r, req, false))
+		return
+	}
+
+	var body json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "Request body too large")
+			return
+		}
+		writeError(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		var batch []request
+		if err := json.Unmarshal(body, &batch); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid input")
+			return
+		}
+		if len(batch) == 0 || len(batch) > maxBatchSize {
+			writeError(w, http.StatusBadRequest, "Batch must contain between 1 and 20 operations")
+			return
+		}
+		// MaxComplexity bounds the whole request, or batching would
+		// multiply it by the batch size
+		results := make([]*graphql.Result, len(batch))
+		total := 0
+		for i, req := range batch {
+			cost, err := h.check(req, true)
+			if err != nil {
+				results[i] = &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+			}
+			total += cost
+		}
+		if h.limits.MaxComplexity > 0 && total > h.limits.MaxComplexity {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("batch complexity %d exceeds the limit of %d", total, h.limits.MaxComplexity))
+			return
+		}
+		for i, req := range batch {
+			if results[i] == nil {
+				results[i] = h.run(r, req)
+			}
+		}
+		json.NewEncoder(w).Encode(results)
+		return
+	}
+
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	h.respond(w, h.execute(r, req, true))
+}
+
+func (h *Handler) execute(r *http.Request, req request, allowMutations bool) *graphql.Result {
+	if _, err := h.check(req, allowMutations); err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+	return h.run(r, req)
+}
+
+// check parses req and enforces the limits on it, returning its cost
+func (h *Handler) check(req request, allowMutations bool) (int, error) {
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(req.Query),
+		Name: "GraphQL request",
+	})})
+	if err != nil {
+		return 0, err
+	}
+
+	cost, err := checkLimits(doc, req.Variables, h.limits)
+	if err != nil {
+		return 0, err
+	}
+
+	if !allowMutations && hasMutation(doc, req.OperationName) {
+		return 0, errMutationOverGet
+	}
+	return cost, nil
+}
+
+// run executes req, which has passed check
+func (h *Handler) run(r *http.Request, req request) *graphql.Result {
+	return graphql.Do(graphql.Params{
+		Schema:         h.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        r.Context(),
+	})
+}
+
+// respond writes a single result. Requests that failed before execution
+// (parse errors, limits) have no data and are answered with 400.
+func (h *Handler) respond(w http.ResponseWriter, result *graphql.Result) {
+	if result.Data == nil && result.HasErrors() {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"message": message}},
+	})
+}
+
+var errMutationOverGet = errors.New("mutations must be sent with POST")
+
+// hasMutation reports whether the operation that will run is a mutation
+func hasMutation(doc *ast.Document, operationName string) bool {
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if operationName == "" || (op.Name != nil && op.Name.Value == operationName) {
+			if op.Operation == ast.OperationTypeMutation {
+				return true
+			}
+		}
+	}
+	return false
+}
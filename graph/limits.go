@@ -0,0 +1,134 @@
+package graph
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Limits bounds how expensive a single query may be. Zero disables a limit.
+type Limits struct {
+	MaxDepth      int `yaml:"max_depth" toml:"max_depth"`
+	MaxComplexity int `yaml:"max_complexity" toml:"max_complexity"`
+}
+
+// DefaultLimits are used by serve unless overridden
+var DefaultLimits = Limits{MaxDepth: 8, MaxComplexity: 1000}
+
+// checkLimits rejects operations in doc that nest deeper than MaxDepth or
+// whose estimated cost exceeds MaxComplexity, and returns the cost of the
+// costliest one. Every field costs 1, and the fields under a paginated list
+// are multiplied by the page size requested.
+func checkLimits(doc *ast.Document, variables map[string]interface{}, limits Limits) (int, error) {
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, def := range doc.Definitions {
+		if frag, ok := def.(*ast.FragmentDefinition); ok {
+			fragments[frag.Name.Value] = frag
+		}
+	}
+
+	w := walker{fragments: fragments, variables: variables}
+	highest := 0
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+
+		depth, cost, err := w.measure(op.SelectionSet, map[string]bool{})
+		if err != nil {
+			return 0, err
+		}
+		if limits.MaxDepth > 0 && depth > limits.MaxDepth {
+			return 0, fmt.Errorf("query depth %d exceeds the limit of %d", depth, limits.MaxDepth)
+		}
+		if limits.MaxComplexity > 0 && cost > limits.MaxComplexity {
+			return 0, fmt.Errorf("query complexity %d exceeds the limit of %d", cost, limits.MaxComplexity)
+		}
+		highest = max(highest, cost)
+	}
+	return highest, nil
+}
+
+type walker struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+// measure returns the depth and cost of set. visiting guards against
+// fragments that spread themselves.
+func (w walker) measure(set *ast.SelectionSet, visiting map[string]bool) (int, int, error) {
+	if set == nil {
+		return 0, 0, nil
+	}
+
+	maxDepth, total := 0, 0
+	for _, sel := range set.Selections {
+		var depth, cost int
+		var err error
+
+		switch s := sel.(type) {
+		case *ast.Field:
+			depth, cost, err = w.measure(s.SelectionSet, visiting)
+			depth++
+			cost = 1 + cost*w.multiplier(s)
+		case *ast.InlineFragment:
+			depth, cost, err = w.measure(s.SelectionSet, visiting)
+		case *ast.FragmentSpread:
+			name := s.Name.Value
+			frag, ok := w.fragments[name]
+			if !ok {
+				return 0, 0, fmt.Errorf("unknown fragment %q", name)
+			}
+			if visiting[name] {
+				return 0, 0, fmt.Errorf("fragment %q spreads itself", name)
+			}
+			visiting[name] = true
+			depth, cost, err = w.measure(frag.SelectionSet, visiting)
+			delete(visiting, name)
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		total += cost
+	}
+	return maxDepth, total, nil
+}
+
+// multiplier is the number of items a field's children are resolved for
+func (w walker) multiplier(f *ast.Field) int {
+	if f.Name.Value != "students" {
+		return 1
+	}
+	for _, arg := range f.Arguments {
+		if arg.Name.Value != "first" {
+			continue
+		}
+		switch v := arg.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(v.Value); err == nil {
+				return max(n, 1)
+			}
+		case *ast.Variable:
+			if n, ok := toInt(w.variables[v.Name.Value]); ok {
+				return max(n, 1)
+			}
+		}
+	}
+	return defaultPageSize
+}
+
+func toInt(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case float64:
+		return int(n), true
+	}
+	return 0, false
+}
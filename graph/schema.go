@@ -0,0 +1,407 @@
+package graph
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"student-server/database"
+	"student-server/models"
+
+	"github.com/graphql-go/graphql"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var studentType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Student",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.ID),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(models.Student).ID, nil
+			},
+		},
+		"name": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(models.Student).Name, nil
+			},
+		},
+		"age": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Int),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(models.Student).Age, nil
+			},
+		},
+		"grade": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(models.Student).Grade, nil
+			},
+		},
+		"createdAt": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.DateTime),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(models.Student).CreatedAt, nil
+			},
+		},
+		"updatedAt": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.DateTime),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(models.Student).UpdatedAt, nil
+			},
+		},
+	},
+})
+
+var studentFilterInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "StudentFilter",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"name":   &graphql.InputObjectFieldConfig{Type: graphql.String, Description: "Case-insensitive substring of the name"},
+		"grade":  &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"minAge": &graphql.InputObjectFieldConfig{Type: graphql.Int},
+		"maxAge": &graphql.InputObjectFieldConfig{Type: graphql.Int},
+	},
+})
+
+var studentSortFieldEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "StudentSortField",
+	Values: graphql.EnumValueConfigMap{
+		"ID":         &graphql.EnumValueConfig{Value: "id"},
+		"NAME":       &graphql.EnumValueConfig{Value: "name"},
+		"AGE":        &graphql.EnumValueConfig{Value: "age"},
+		"GRADE":      &graphql.EnumValueConfig{Value: "grade"},
+		"CREATED_AT": &graphql.EnumValueConfig{Value: "created_at"},
+		"UPDATED_AT": &graphql.EnumValueConfig{Value: "updated_at"},
+	},
+})
+
+var sortDirectionEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "SortDirection",
+	Values: graphql.EnumValueConfigMap{
+		"ASC":  &graphql.EnumValueConfig{Value: "asc"},
+		"DESC": &graphql.EnumValueConfig{Value: "desc"},
+	},
+})
+
+var studentSortInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "StudentSort",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"field":     &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(studentSortFieldEnum)},
+		"direction": &graphql.InputObjectFieldConfig{Type: sortDirectionEnum, DefaultValue: "asc"},
+	},
+})
+
+var pageInfoType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PageInfo",
+	Fields: graphql.Fields{
+		"hasNextPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"endCursor":   &graphql.Field{Type: graphql.String},
+	},
+})
+
+var studentEdgeType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "StudentEdge",
+	Fields: graphql.Fields{
+		"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"node":   &graphql.Field{Type: graphql.NewNonNull(studentType)},
+	},
+})
+
+var createStudentInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "CreateStudentInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"name":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"age":   &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Int)},
+		"grade": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+	},
+})
+
+var updateStudentInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "UpdateStudentInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"name":  &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"age":   &graphql.InputObjectFieldConfig{Type: graphql.Int},
+		"grade": &graphql.InputObjectFieldConfig{Type: graphql.String},
+	},
+})
+
+// connection is the resolved value of the students query
+type connection struct {
+	Edges    []edge   `json:"edges"`
+	PageInfo pageInfo `json:"pageInfo"`
+	filter   database.StudentFilter
+}
+
+type edge struct {
+	Cursor string         `json:"cursor"`
+	Node   models.Student `json:"node"`
+}
+
+type pageInfo struct {
+	HasNextPage bool    `json:"hasNextPage"`
+	EndCursor   *string `json:"endCursor"`
+}
+
+// NewSchema builds the GraphQL schema backed by db. Queries read from db
+// too, never from a read replica: a batch may mix mutations and queries,
+// and those queries must see the mutations that ran before them.
+func NewSchema(db *gorm.DB) (graphql.Schema, error) {
+	connectionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "StudentConnection",
+		Fields: graphql.Fields{
+			"edges":    &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(studentEdgeType)))},
+			"pageInfo": &graphql.Field{Type: graphql.NewNonNull(pageInfoType)},
+			"totalCount": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Int),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					count, err := database.CountStudents(p.Context, db, p.Source.(connection).filter)
+					return int(count), err
+				},
+			},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"students": &graphql.Field{
+				Type: graphql.NewNonNull(connectionType),
+				Args: graphql.FieldConfigArgument{
+					"filter": &graphql.ArgumentConfig{Type: studentFilterInput},
+					"sort":   &graphql.ArgumentConfig{Type: studentSortInput},
+					"first":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPageSize},
+					"after":  &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return resolveStudents(p.Context, db, p.Args)
+				},
+			},
+			"student": &graphql.Field{
+				Type: studentType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := parseID(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					student, err := database.CachedStudent(p.Context, db, id)
+					if errors.Is(err, database.ErrStudentNotFound) {
+						return nil, nil
+					}
+					if err != nil {
+						return nil, err
+					}
+					return *student, nil
+				},
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createStudent": &graphql.Field{
+				Type: graphql.NewNonNull(studentType),
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(createStudentInput)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					var student models.Student
+					applyInput(&student, p.Args["input"].(map[string]interface{}))
+					if err := database.CreateStudent(p.Context, db, &student); err != nil {
+						return nil, err
+					}
+					return student, nil
+				},
+			},
+			"updateStudent": &graphql.Field{
+				Type: graphql.NewNonNull(studentType),
+				Args: graphql.FieldConfigArgument{
+					"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(updateStudentInput)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := parseID(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					student, err := database.GetStudent(p.Context, db, id)
+					if err != nil {
+						return nil, err
+					}
+					applyInput(student, p.Args["input"].(map[string]interface{}))
+					if err := database.UpdateStudent(p.Context, db, student); err != nil {
+						return nil, err
+					}
+					return *student, nil
+				},
+			},
+			"deleteStudent": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.ID),
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := parseID(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					student, err := database.GetStudent(p.Context, db, id)
+					if err != nil {
+						return nil, err
+					}
+					if err := database.DeleteStudent(p.Context, db, student); err != nil {
+						return nil, err
+					}
+					return id, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+func resolveStudents(ctx context.Context, db *gorm.DB, args map[string]interface{}) (interface{}, error) {
+	q := database.StudentQuery{SortBy: "id", Limit: defaultPageSize}
+
+	if first, ok := args["first"].(int); ok {
+		if first < 0 || first > maxPageSize {
+			return nil, fmt.Errorf("first must be between 0 and %d", maxPageSize)
+		}
+		q.Limit = first
+	}
+	if f, ok := args["filter"].(map[string]interface{}); ok {
+		q.Filter.Name, _ = f["name"].(string)
+		q.Filter.Grade, _ = f["grade"].(string)
+		q.Filter.MinAge, _ = f["minAge"].(int)
+		q.Filter.MaxAge, _ = f["maxAge"].(int)
+	}
+	if s, ok := args["sort"].(map[string]interface{}); ok {
+		q.SortBy, _ = s["field"].(string)
+		q.Desc = s["direction"] == "desc"
+	}
+	if after, ok := args["after"].(string); ok && after != "" {
+		last, err := decodeCursor(after, q.SortBy)
+		if err != nil {
+			return nil, err
+		}
+		q.After = last
+	}
+
+	conn := connection{Edges: []edge{}, filter: q.Filter}
+	if q.Limit == 0 {
+		return conn, nil
+	}
+
+	// Fetch one extra row to learn whether another page follows
+	limit := q.Limit
+	q.Limit++
+	students, err := database.CachedStudents(ctx, db, q)
+	if err != nil {
+		return nil, err
+	}
+	if len(students) > limit {
+		conn.PageInfo.HasNextPage = true
+		students = students[:limit]
+	}
+
+	for _, s := range students {
+		conn.Edges = append(conn.Edges, edge{Cursor: encodeCursor(s, q.SortBy), Node: s})
+	}
+	if n := len(conn.Edges); n > 0 {
+		conn.PageInfo.EndCursor = &conn.Edges[n-1].Cursor
+	}
+	return conn, nil
+}
+
+// cursor is the position of a row in a sorted result set: its sort value
+// and ID, so the next page starts right after it even when rows were added
+// or removed in between
+type cursor struct {
+	SortBy    string     `json:"sort"`
+	ID        uint       `json:"id"`
+	Name      string     `json:"name,omitempty"`
+	Age       int        `json:"age,omitempty"`
+	Grade     string     `json:"grade,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// Cursors are opaque to clients; they encode the position of student when
+// sorted by sortBy
+func encodeCursor(student models.Student, sortBy string) string {
+	c := cursor{SortBy: sortBy, ID: student.ID}
+	switch sortBy {
+	case "name":
+		c.Name = student.Name
+	case "age":
+		c.Age = student.Age
+	case "grade":
+		c.Grade = student.Grade
+	case "created_at":
+		c.CreatedAt = &student.CreatedAt
+	case "updated_at":
+		c.UpdatedAt = &student.UpdatedAt
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor returns the student a cursor points after. It must come
+// from a query with the same sort.
+func decodeCursor(encoded, sortBy string) (*models.Student, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == 0 {
+		return nil, errors.New("invalid cursor")
+	}
+	if c.SortBy != sortBy {
+		return nil, errors.New("cursor is from a query with a different sort")
+	}
+	last := &models.Student{Name: c.Name, Age: c.Age, Grade: c.Grade}
+	last.ID = c.ID
+	if c.CreatedAt != nil {
+		last.CreatedAt = *c.CreatedAt
+	}
+	if c.UpdatedAt != nil {
+		last.UpdatedAt = *c.UpdatedAt
+	}
+	return last, nil
+}
+
+func parseID(v interface{}) (uint, error) {
+	s, _ := v.(string)
+	id, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid student ID")
+	}
+	return uint(id), nil
+}
+
+func applyInput(student *models.Student, input map[string]interface{}) {
+	if name, ok := input["name"].(string); ok {
+		student.Name = name
+	}
+	if age, ok := input["age"].(int); ok {
+		student.Age = age
+	}
+	if grade, ok := input["grade"].(string); ok {
+		student.Grade = grade
+	}
+}
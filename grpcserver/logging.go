@@ -0,0 +1,80 @@
+package grpcserver
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"student-server/logging"
+	"student-server/middleware"
+
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDKey is the metadata key carrying the request ID, the gRPC
+// counterpart of the X-Request-ID header
+var requestIDKey = strings.ToLower(middleware.RequestIDHeader)
+
+// UnaryLogInterceptor gives every call a request ID, as the REST
+// middleware does, and writes one access log record once it has finished
+func UnaryLogInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx = withRequestID(ctx)
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, logging.RequestID(ctx)))
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logCall(ctx, info.FullMethod, err, start)
+	return resp, err
+}
+
+// StreamLogInterceptor is the streaming counterpart of UnaryLogInterceptor
+func StreamLogInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx := withRequestID(ss.Context())
+	ss.SetHeader(metadata.Pairs(requestIDKey, logging.RequestID(ctx)))
+	start := time.Now()
+	err := handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	logCall(ctx, info.FullMethod, err, start)
+	return err
+}
+
+func withRequestID(ctx context.Context) context.Context {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDKey); len(values) > 0 {
+			id = values[0]
+		}
+	}
+	ctx = logging.WithRequestID(ctx, middleware.UsableRequestID(id))
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		ctx = logging.WithLogger(ctx, logging.FromContext(ctx).With("trace_id", span.TraceID().String()))
+	}
+	return ctx
+}
+
+// logCall logs a finished call. Calls that failed on the server's side
+// are logged at error level, everything else at info level.
+func logCall(ctx context.Context, method string, err error, start time.Time) {
+	code := status.Code(err)
+	level := slog.LevelInfo
+	switch code {
+	case codes.Unknown, codes.Internal, codes.DataLoss, codes.Unavailable:
+		level = slog.LevelError
+	}
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.String("code", code.String()),
+		slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		attrs = append(attrs, slog.String("remote_addr", p.Addr.String()))
+	}
+	if principal := logging.Principal(ctx); principal != "" {
+		attrs = append(attrs, slog.String("user", principal))
+	}
+	logging.FromContext(ctx).LogAttrs(ctx, level, "rpc", attrs...)
+}
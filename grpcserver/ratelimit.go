@@ -0,0 +1,48 @@
+package grpcserver
+
+import (
+	"context"
+	"sync/atomic"
+
+	"student-server/ratelimit"
+
+	"google.golang.org/grpc"
+)
+
+var limiter atomic.Pointer[ratelimit.Limiter]
+
+// SetRateLimiter makes calls count against the limits of l, or turns
+// limiting off when l is nil
+func SetRateLimiter(l *ratelimit.Limiter) {
+	limiter.Store(l)
+}
+
+// UnaryRateLimitInterceptor limits calls to the rate limit of group. The
+// health and reflection services are not limited.
+func UnaryRateLimitInterceptor(group string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := rateLimit(ctx, group, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamRateLimitInterceptor is the streaming counterpart of
+// UnaryRateLimitInterceptor
+func StreamRateLimitInterceptor(group string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := rateLimit(ss.Context(), group, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func rateLimit(ctx context.Context, group, method string) error {
+	l := limiter.Load()
+	if l == nil || public(method) {
+		return nil
+	}
+	return l.AllowRPC(ctx, group)
+}
@@ -0,0 +1,206 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"student-server/database"
+	"student-server/metrics"
+	"student-server/models"
+	"student-server/ratelimit"
+	pb "student-server/studentpb"
+	"student-server/tracing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// listBatchSize is how many rows ListStudents reads from the database at a time
+const listBatchSize = 100
+
+// studentServer implements pb.StudentServiceServer on top of the database package
+type studentServer struct {
+	pb.UnimplementedStudentServiceServer
+	db *gorm.DB
+}
+
+// New creates a gRPC server exposing StudentService, the standard health
+// service and server reflection, with opts added to the server's options.
+// Calls are traced, measured and logged like REST requests, failed
+// authentication included, and rate limited by address before
+// authentication and in the students group after it. The returned health
+// server can be used to flip the serving status during shutdown.
+func New(db *gorm.DB, opts ...grpc.ServerOption) (*grpc.Server, *health.Server) {
+	server := grpc.NewServer(append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(tracing.UnaryServerInterceptor, UnaryLogInterceptor, metrics.UnaryServerInterceptor,
+			UnaryRateLimitInterceptor(ratelimit.GroupAuth), UnaryAuthInterceptor, UnaryRateLimitInterceptor(ratelimit.GroupStudents)),
+		grpc.ChainStreamInterceptor(tracing.StreamServerInterceptor, StreamLogInterceptor, metrics.StreamServerInterceptor,
+			StreamRateLimitInterceptor(ratelimit.GroupAuth), StreamAuthInterceptor, StreamRateLimitInterceptor(ratelimit.GroupStudents)),
+	}, opts...)...)
+
+	pb.RegisterStudentServiceServer(server, &studentServer{db: db})
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(pb.StudentService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	reflection.Register(server)
+	return server, healthServer
+}
+
+func (s *studentServer) ListStudents(req *pb.ListStudentsRequest, stream grpc.ServerStreamingServer[pb.Student]) error {
+	if !database.ValidSortKey(req.SortBy) {
+		return status.Errorf(codes.InvalidArgument, "cannot sort by %q", req.SortBy)
+	}
+
+	q := database.StudentQuery{
+		Filter: database.StudentFilter{
+			Name:   req.Name,
+			Grade:  req.Grade,
+			MinAge: int(req.MinAge),
+			MaxAge: int(req.MaxAge),
+		},
+		SortBy: req.SortBy,
+		Desc:   req.Descending,
+		Limit:  listBatchSize,
+	}
+
+	// Read in batches so large rosters are never held in memory at once.
+	// Each batch starts after the last student sent rather than at an
+	// offset, so students added or removed meanwhile don't shift the rest.
+	for {
+		if err := stream.Context().Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+
+		students, err := database.ListStudents(stream.Context(), s.db, q)
+		if err != nil {
+			return dbError(stream.Context(), err, "failed to fetch students")
+		}
+		for _, student := range students {
+			if err := stream.Send(toProto(student)); err != nil {
+				return err
+			}
+		}
+		if len(students) < listBatchSize {
+			return nil
+		}
+		q.After = &students[len(students)-1]
+	}
+}
+
+func (s *studentServer) GetStudent(ctx context.Context, req *pb.GetStudentRequest) (*pb.Student, error) {
+	student, err := s.lookup(ctx, req.Id, database.CachedStudent)
+	if err != nil {
+		return nil, err
+	}
+	return toProto(*student), nil
+}
+
+func (s *studentServer) CreateStudent(ctx context.Context, req *pb.CreateStudentRequest) (*pb.Student, error) {
+	student := models.Student{Name: req.Name, Age: int(req.Age), Grade: req.Grade}
+	if err := student.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := database.CreateStudent(ctx, s.db, &student); err != nil {
+		return nil, dbError(ctx, err, "failed to add student")
+	}
+	return toProto(student), nil
+}
+
+func (s *studentServer) UpdateStudent(ctx context.Context, req *pb.UpdateStudentRequest) (*pb.Student, error) {
+	student, err := s.lookup(ctx, req.Id, database.GetStudent)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		student.Name = *req.Name
+	}
+	if req.Age != nil {
+		student.Age = int(*req.Age)
+	}
+	if req.Grade != nil {
+		student.Grade = *req.Grade
+	}
+	if err := student.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := database.UpdateStudent(ctx, s.db, student); err != nil {
+		return nil, dbError(ctx, err, "failed to update student")
+	}
+	return toProto(*student), nil
+}
+
+func (s *studentServer) DeleteStudent(ctx context.Context, req *pb.DeleteStudentRequest) (*pb.DeleteStudentResponse, error) {
+	student, err := s.lookup(ctx, req.Id, database.GetStudent)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := database.DeleteStudent(ctx, s.db, student); err != nil {
+		return nil, dbError(ctx, err, "failed to delete student")
+	}
+	return &pb.DeleteStudentResponse{}, nil
+}
+
+// lookup loads a student by ID with get, translating errors to gRPC status
+// codes. Students about to be changed must not come from the cache.
+func (s *studentServer) lookup(ctx context.Context, id uint64, get func(context.Context, *gorm.DB, uint) (*models.Student, error)) (*models.Student, error) {
+	if id == 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid student ID")
+	}
+
+	student, err := get(ctx, s.db, uint(id))
+	if errors.Is(err, database.ErrStudentNotFound) {
+		return nil, status.Error(codes.NotFound, "student not found")
+	}
+	if err != nil {
+		return nil, dbError(ctx, err, "failed to fetch student")
+	}
+	return student, nil
+}
+
+// dbError translates a failed database call to a gRPC status: Canceled or
+// DeadlineExceeded when the call's context ended, Internal otherwise
+func dbError(ctx context.Context, err error, msg string) error {
+	if ctx.Err() != nil {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	return status.Error(codes.Internal, msg)
+}
+
+func toProto(s models.Student) *pb.Student {
+	return &pb.Student{
+		Id:        uint64(s.ID),
+		Name:      s.Name,
+		Age:       int32(s.Age),
+		Grade:     s.Grade,
+		CreatedAt: timestamppb.New(s.CreatedAt),
+		UpdatedAt: timestamppb.New(s.UpdatedAt),
+	}
+}
+
+// Multiplex routes gRPC requests to grpcServer and everything else to
+// httpHandler, so both can share one listener
+func Multiplex(grpcServer *grpc.Server, httpHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcServer.ServeHTTP(w, r)
+			return
+		}
+		httpHandler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"student-server/logging"
+)
+
+// StatusClientClosedRequest is the non-standard status (borrowed from
+// nginx) recorded when the client goes away before the response is ready
+const StatusClientClosedRequest = 499
+
+// QueryTimeouts bound how long a route may spend on its database work. A
+// zero timeout means no limit.
+type QueryTimeouts struct {
+	Read  time.Duration `yaml:"read" toml:"read"`   // fetching a single record
+	List  time.Duration `yaml:"list" toml:"list"`   // listing records, which can be large
+	Write time.Duration `yaml:"write" toml:"write"` // creating, updating and deleting
+}
+
+// DefaultQueryTimeouts are the timeouts used unless configured otherwise
+var DefaultQueryTimeouts = QueryTimeouts{
+	Read:  5 * time.Second,
+	List:  15 * time.Second,
+	Write: 10 * time.Second,
+}
+
+// WithQueryTimeout runs next with a request context that expires after
+// timeout, so database calls made with it are abandoned in time
+func WithQueryTimeout(timeout time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	if timeout <= 0 {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// dbError responds to a failed database call: 499 when the client has
+// gone away, 504 when the query ran out of time, and 500 with msg otherwise
+func dbError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	logger := logging.FromContext(r.Context())
+	ctxErr := r.Context().Err()
+	switch {
+	case errors.Is(ctxErr, context.Canceled) || errors.Is(err, context.Canceled):
+		logger.Info("client closed request", "error", err)
+		http.Error(w, "Client closed request", StatusClientClosedRequest)
+	case errors.Is(ctxErr, context.DeadlineExceeded) || errors.Is(err, context.DeadlineExceeded):
+		logger.Warn("query timed out", "error", err)
+		http.Error(w, "Request timed out", http.StatusGatewayTimeout)
+	default:
+		logger.Error(msg, "error", err)
+		http.Error(w, msg, http.StatusInternalServerError)
+	}
+}
+
+// invalidBody responds to a request body that could not be decoded: 413 if
+// it was over the size limit, 400 otherwise
+func invalidBody(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, "Invalid input", http.StatusBadRequest)
+}
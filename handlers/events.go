@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"student-server/events"
+	"student-server/logging"
+)
+
+var (
+	broker *events.Broker
+
+	// HeartbeatInterval is how often an idle event stream sends a comment
+	// line to keep proxies from closing the connection
+	HeartbeatInterval = 15 * time.Second
+
+	// EventBufferSize is how many undelivered events a client may fall
+	// behind by before it is disconnected
+	EventBufferSize = 64
+)
+
+// SetEventBroker sets the broker that StudentEventsHandler streams from
+func SetEventBroker(b *events.Broker) {
+	broker = b
+}
+
+// StudentEventsHandler streams student changes as Server-Sent Events.
+// Clients resume after a reconnect by sending the Last-Event-ID header
+// (or a lastEventId query parameter). Missed events come from the
+// broker's history, else from its backlog; if they are no longer retained
+// clients receive a "resync" event and should refetch.
+func StudentEventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	lastID, err := lastEventID(r)
+	if err != nil {
+		http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+		return
+	}
+
+	// The server's read and write timeouts are meant for ordinary requests;
+	// a stream is open for as long as the client is listening
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+
+	sub, missed, complete, err := broker.Resume(r.Context(), lastID, EventBufferSize)
+	defer broker.Unsubscribe(sub)
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("failed to look up missed events, asking the client to resync", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if !complete {
+		fmt.Fprint(w, "event: resync\ndata: {}\n\n")
+	}
+	// Events replayed from the backlog may arrive live as well
+	replayed := make(map[uint64]bool, len(missed))
+	for _, e := range missed {
+		writeEvent(w, e)
+		replayed[e.ID] = true
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(HeartbeatInterval)
+	defer heartbeat.Stop()
+	closing := closingStreams()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-closing:
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				logging.FromContext(r.Context()).Warn("event stream client fell behind, disconnecting")
+				return
+			}
+			if replayed[e.ID] {
+				delete(replayed, e.ID)
+				continue
+			}
+			writeEvent(w, e)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func lastEventID(r *http.Request) (uint64, error) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("lastEventId")
+	}
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+func writeEvent(w http.ResponseWriter, e events.Event) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+}
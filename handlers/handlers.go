@@ -3,12 +3,15 @@ package handlers
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"student-server/database"
 	"student-server/models"
 
 	"github.com/gorilla/mux"
@@ -20,7 +23,7 @@ var db *gorm.DB
 // SetDB sets the database instance to be used in the handlers
 func SetDB(database *gorm.DB) {
 	db = database
-	log.Println("Database instance set in handlers")
+	slog.Debug("database instance set in handlers")
 }
 
 // BasicAuthMiddleware checks for valid basic authentication.
@@ -60,35 +63,67 @@ func HomeHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetStudentsHandler retrieves all students from the database
-func GetStudentsHandler(w http.ResponseWriter, _ *http.Request) {
+func GetStudentsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	var students []models.Student
-	if err := db.Find(&students).Error; err != nil {
-		http.Error(w, "Failed to fetch students", http.StatusInternalServerError)
+	list := database.CachedStudents
+	if wantsPrimary(r) {
+		list = database.ListStudents
+	}
+	students, err := list(r.Context(), dbFor(r), database.StudentQuery{})
+	if err != nil {
+		dbError(w, r, err, "Failed to fetch students")
+		return
+	}
+	if listNotModified(w, r, students) {
 		return
 	}
-
-	// Log and simulate slow request (optional)
-	log.Println("Processing request: Fetching students...")
-	time.Sleep(1 * time.Second)
-	log.Println("Request completed: Students fetched")
 
 	json.NewEncoder(w).Encode(students)
 }
 
+// listNotModified sets the caching headers of a student list and answers
+// 304 if the client's copy is still current. A deleted student leaves no
+// modification time behind, so instead of Last-Modified the list gets an
+// ETag from the number of students and the latest change among them.
+func listNotModified(w http.ResponseWriter, r *http.Request, students []models.Student) bool {
+	var latest time.Time
+	for _, student := range students {
+		if student.UpdatedAt.After(latest) {
+			latest = student.UpdatedAt
+		}
+	}
+	etag := fmt.Sprintf(`W/"%d-%d"`, len(students), latest.UnixNano())
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("ETag", etag)
+
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		// ETags compare weakly, so the W/ prefix doesn't matter
+		if tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/"); tag == "*" || tag == strings.TrimPrefix(etag, "W/") {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
 // AddStudentHandler adds a new student to the database
 func AddStudentHandler(w http.ResponseWriter, r *http.Request) {
 	var student models.Student
 	if err := json.NewDecoder(r.Body).Decode(&student); err != nil {
+		invalidBody(w, err)
+		return
+	}
+	if err := student.Validate(); err != nil {
 		http.Error(w, "Invalid input", http.StatusBadRequest)
 		return
 	}
 
-	if err := db.Create(&student).Error; err != nil {
-		http.Error(w, "Failed to add student", http.StatusInternalServerError)
+	if err := database.CreateStudent(r.Context(), db, &student); err != nil {
+		dbError(w, r, err, "Failed to add student")
 		return
 	}
+	recordWrite(r)
 
 	w.WriteHeader(http.StatusCreated)
 	fmt.Fprintln(w, "Student added successfully")
@@ -96,12 +131,11 @@ func AddStudentHandler(w http.ResponseWriter, r *http.Request) {
 
 // GetStudentByIDHandler retrieves a student by ID
 func GetStudentByIDHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
-
-	var student models.Student
-	if err := db.First(&student, id).Error; err != nil {
-		http.Error(w, "Student not found", http.StatusNotFound)
+	student, ok := lookupStudent(w, r)
+	if !ok {
+		return
+	}
+	if notModified(w, r, student.UpdatedAt) {
 		return
 	}
 
@@ -109,26 +143,48 @@ func GetStudentByIDHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(student)
 }
 
+// notModified sets the caching headers of a record last changed at
+// modified, and answers 304 if the client's copy is still current. Clients
+// may keep the record but must check it is current before using it again.
+func notModified(w http.ResponseWriter, r *http.Request, modified time.Time) bool {
+	// HTTP dates have whole seconds
+	modified = modified.UTC().Truncate(time.Second)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || modified.After(since) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
 // UpdateStudentHandler updates an existing student's details
 func UpdateStudentHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
-
-	var student models.Student
-	if err := db.First(&student, id).Error; err != nil {
-		http.Error(w, "Student not found", http.StatusNotFound)
+	student, ok := lookupStudent(w, r)
+	if !ok {
 		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&student); err != nil {
+	id, createdAt := student.ID, student.CreatedAt
+	if err := json.NewDecoder(r.Body).Decode(student); err != nil {
+		invalidBody(w, err)
+		return
+	}
+	// The URL names the student; an ID or creation time in the body must not
+	// turn the update into an insert or rewrite history
+	student.ID, student.CreatedAt = id, createdAt
+	if err := student.Validate(); err != nil {
 		http.Error(w, "Invalid input", http.StatusBadRequest)
 		return
 	}
 
-	if err := db.Save(&student).Error; err != nil {
-		http.Error(w, "Failed to update student", http.StatusInternalServerError)
+	if err := database.UpdateStudent(r.Context(), db, student); err != nil {
+		dbError(w, r, err, "Failed to update student")
 		return
 	}
+	recordWrite(r)
 
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintln(w, "Student updated successfully")
@@ -136,20 +192,44 @@ func UpdateStudentHandler(w http.ResponseWriter, r *http.Request) {
 
 // DeleteStudentHandler deletes a student by ID
 func DeleteStudentHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
-
-	var student models.Student
-	if err := db.First(&student, id).Error; err != nil {
-		http.Error(w, "Student not found", http.StatusNotFound)
+	student, ok := lookupStudent(w, r)
+	if !ok {
 		return
 	}
 
-	if err := db.Delete(&student).Error; err != nil {
-		http.Error(w, "Failed to delete student", http.StatusInternalServerError)
+	if err := database.DeleteStudent(r.Context(), db, student); err != nil {
+		dbError(w, r, err, "Failed to delete student")
 		return
 	}
+	recordWrite(r)
 
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintln(w, "Student deleted successfully")
 }
+
+// lookupStudent loads the student named by the {id} route variable, writing
+// an error response and returning false if it can't
+func lookupStudent(w http.ResponseWriter, r *http.Request) (*models.Student, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid student ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	// Only plain reads may come from the cache; a student about to be
+	// changed is always read from the database
+	get := database.GetStudent
+	if r.Method == http.MethodGet && !wantsPrimary(r) {
+		get = database.CachedStudent
+	}
+	student, err := get(r.Context(), dbFor(r), uint(id))
+	if errors.Is(err, database.ErrStudentNotFound) {
+		http.Error(w, "Student not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		dbError(w, r, err, "Failed to fetch student")
+		return nil, false
+	}
+	return student, true
+}
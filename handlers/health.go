@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"student-server/database"
+)
+
+// ReadinessTimeout bounds each readiness check so a hung database fails the
+// probe instead of stalling it
+var ReadinessTimeout = 2 * time.Second
+
+var shuttingDown atomic.Bool
+
+// SetShuttingDown marks the server as draining; /readyz fails from then on
+// so load balancers stop sending new requests
+func SetShuttingDown(draining bool) {
+	shuttingDown.Store(draining)
+}
+
+// HealthStatus is the body of /healthz and /readyz
+type HealthStatus struct {
+	Status     string                     `json:"status"` // "ok" or "unavailable"
+	Components map[string]ComponentStatus `json:"components,omitempty"`
+}
+
+// ComponentStatus is the outcome of one readiness check
+type ComponentStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// HealthzHandler reports that the process is up. It checks nothing else, so
+// a slow database never gets the server restarted.
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, HealthStatus{Status: "ok"})
+}
+
+// ReadyzHandler reports whether the server should receive traffic: the
+// database answers, every migration is applied and it is not shutting down
+func ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), ReadinessTimeout)
+	defer cancel()
+
+	checks := map[string]func(context.Context) error{
+		"database":   pingDatabase,
+		"migrations": checkMigrations,
+		"shutdown": func(context.Context) error {
+			if shuttingDown.Load() {
+				return fmt.Errorf("server is shutting down")
+			}
+			return nil
+		},
+	}
+
+	health := HealthStatus{Status: "ok", Components: map[string]ComponentStatus{}}
+	for name, check := range checks {
+		if err := check(ctx); err != nil {
+			health.Status = "unavailable"
+			health.Components[name] = ComponentStatus{Status: "unavailable", Error: err.Error()}
+		} else {
+			health.Components[name] = ComponentStatus{Status: "ok"}
+		}
+	}
+	writeHealth(w, health)
+}
+
+func pingDatabase(ctx context.Context) error {
+	if db == nil {
+		return fmt.Errorf("not connected")
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+func checkMigrations(ctx context.Context) error {
+	if db == nil {
+		return fmt.Errorf("not connected")
+	}
+	m, err := database.NewMigratorFor(db.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	status, err := m.Status()
+	if err != nil {
+		return err
+	}
+	pending := 0
+	for _, s := range status {
+		if !s.Applied {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("%d pending migrations", pending)
+	}
+	return nil
+}
+
+func writeHealth(w http.ResponseWriter, health HealthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if health.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(health)
+}
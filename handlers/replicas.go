@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"student-server/auth"
+	"student-server/database"
+
+	"gorm.io/gorm"
+)
+
+// ReadConsistencyHeader lets a client send "X-Read-Consistency: primary"
+// to read from the primary even when replicas are configured
+const ReadConsistencyHeader = "X-Read-Consistency"
+
+// PrimaryReadWindow is how long after a client writes that its reads keep
+// going to the primary, so it sees its own changes despite replication lag
+var PrimaryReadWindow = 5 * time.Second
+
+var (
+	replicas   *database.Cluster
+	lastWrites sync.Map     // client -> time of its last write
+	lastPrune  atomic.Int64 // unix nanos of the last sweep of lastWrites
+)
+
+// SetReadReplicas makes GET requests read from the cluster's replicas, or
+// only from the primary again when cluster is nil
+func SetReadReplicas(cluster *database.Cluster) {
+	replicas = cluster
+	if cluster != nil {
+		slog.Info("reading from replicas", "replicas", len(cluster.Replicas))
+	}
+}
+
+// dbFor returns the database to serve r from, bound to r's context: a
+// replica for reads, unless the client wrote recently or asked for the
+// primary, and the primary for everything else
+func dbFor(r *http.Request) *gorm.DB {
+	return pick(r).WithContext(r.Context())
+}
+
+func pick(r *http.Request) *gorm.DB {
+	if replicas == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) || wantsPrimary(r) {
+		return db
+	}
+	return replicas.Reader()
+}
+
+// wantsPrimary reports whether r must see the latest data, as the client
+// asked for the primary or wrote recently. Such reads skip the cache too.
+func wantsPrimary(r *http.Request) bool {
+	if strings.EqualFold(r.Header.Get(ReadConsistencyHeader), "primary") {
+		return true
+	}
+	last, ok := lastWrites.Load(clientKey(r))
+	return ok && time.Since(last.(time.Time)) < PrimaryReadWindow
+}
+
+// recordWrite notes that the client behind r has just changed data
+func recordWrite(r *http.Request) {
+	if replicas == nil {
+		return
+	}
+	now := time.Now()
+	lastWrites.Store(clientKey(r), now)
+	pruneWrites(now)
+}
+
+// pruneWrites drops clients whose window has passed, at most once per
+// window, so the map doesn't grow with every client that ever wrote
+func pruneWrites(now time.Time) {
+	last := lastPrune.Load()
+	if now.UnixNano()-last < int64(PrimaryReadWindow) || !lastPrune.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+	lastWrites.Range(func(key, value any) bool {
+		if now.Sub(value.(time.Time)) >= PrimaryReadWindow {
+			lastWrites.CompareAndDelete(key, value)
+		}
+		return true
+	})
+}
+
+// TrackedWriters returns how many clients currently have their reads
+// pinned to the primary
+func TrackedWriters() int {
+	n := 0
+	lastWrites.Range(func(_, _ any) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// clientKey identifies the client for read-your-own-writes routing
+func clientKey(r *http.Request) string {
+	user, _ := auth.UserFromContext(r.Context())
+	return user
+}
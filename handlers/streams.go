@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+)
+
+// Event streams and WebSockets stay open until the client leaves, so a
+// graceful shutdown has to end them: http.Server.Shutdown doesn't wait for
+// hijacked connections and would wait forever for open event streams.
+var (
+	streamsMu     sync.Mutex
+	streamsClosed = make(chan struct{})
+
+	webSockets sync.WaitGroup
+)
+
+// closingStreams returns a channel that is closed when CloseStreams is called
+func closingStreams() <-chan struct{} {
+	streamsMu.Lock()
+	defer streamsMu.Unlock()
+	return streamsClosed
+}
+
+// CloseStreams ends every open event stream and WebSocket. WebSocket
+// clients are sent a "going away" close frame so they know to reconnect
+// elsewhere. It is safe to call more than once.
+func CloseStreams() {
+	streamsMu.Lock()
+	defer streamsMu.Unlock()
+	select {
+	case <-streamsClosed:
+	default:
+		close(streamsClosed)
+	}
+}
+
+// ReopenStreams lets new event streams and WebSockets stay open again after
+// CloseStreams
+func ReopenStreams() {
+	streamsMu.Lock()
+	defer streamsMu.Unlock()
+	select {
+	case <-streamsClosed:
+		streamsClosed = make(chan struct{})
+	default:
+	}
+}
+
+// WaitForWebSockets waits until every WebSocket has been closed or ctx is done
+func WaitForWebSockets(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		webSockets.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"student-server/events"
+	"student-server/models"
+	"student-server/webhooks"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+var webhookEventTypes = []events.Type{events.StudentCreated, events.StudentUpdated, events.StudentDeleted}
+
+// webhookRequest is the body accepted when creating a subscription
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+}
+
+// webhookView is how subscriptions are returned. The secret is only
+// included in the response to the create request.
+type webhookView struct {
+	ID        uint      `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func toWebhookView(s models.WebhookSubscription) webhookView {
+	return webhookView{ID: s.ID, URL: s.URL, Events: s.Events(), Active: s.Active, CreatedAt: s.CreatedAt}
+}
+
+// CreateWebhookHandler registers a new webhook subscription
+func CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidBody(w, err)
+		return
+	}
+
+	if err := webhooks.CheckURL(r.Context(), req.URL); err != nil {
+		http.Error(w, "Invalid webhook URL: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Events) == 0 {
+		for _, t := range webhookEventTypes {
+			req.Events = append(req.Events, string(t))
+		}
+	}
+	for _, e := range req.Events {
+		if !validWebhookEvent(e) {
+			http.Error(w, "Unknown event type: "+e, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if req.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			http.Error(w, "Failed to generate secret", http.StatusInternalServerError)
+			return
+		}
+		req.Secret = hex.EncodeToString(secret)
+	}
+
+	sub := models.WebhookSubscription{
+		URL:        req.URL,
+		EventTypes: strings.Join(req.Events, ","),
+		Secret:     req.Secret,
+		Active:     true,
+	}
+	if err := dbFor(r).Create(&sub).Error; err != nil {
+		dbError(w, r, err, "Failed to add webhook")
+		return
+	}
+	recordWrite(r)
+
+	view := toWebhookView(sub)
+	view.Secret = sub.Secret
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(view)
+}
+
+// GetWebhooksHandler lists all webhook subscriptions
+func GetWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	var subs []models.WebhookSubscription
+	if err := dbFor(r).Order("id").Find(&subs).Error; err != nil {
+		dbError(w, r, err, "Failed to fetch webhooks")
+		return
+	}
+
+	views := make([]webhookView, 0, len(subs))
+	for _, s := range subs {
+		views = append(views, toWebhookView(s))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
+
+// GetWebhookHandler retrieves a webhook subscription by ID
+func GetWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	sub, ok := lookupWebhook(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toWebhookView(*sub))
+}
+
+// DeleteWebhookHandler removes a webhook subscription
+func DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	sub, ok := lookupWebhook(w, r)
+	if !ok {
+		return
+	}
+	if err := dbFor(r).Delete(sub).Error; err != nil {
+		dbError(w, r, err, "Failed to delete webhook")
+		return
+	}
+	recordWrite(r)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Webhook deleted successfully\n"))
+}
+
+// GetWebhookDeliveriesHandler lists the most recent deliveries of a subscription
+func GetWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	sub, ok := lookupWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries := []models.WebhookDelivery{}
+	if err := dbFor(r).Where("subscription_id = ?", sub.ID).Order("id DESC").Limit(100).Find(&deliveries).Error; err != nil {
+		dbError(w, r, err, "Failed to fetch deliveries")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// GetWebhookDeliveryHandler shows a delivery together with its attempt log
+func GetWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	delivery, ok := lookupDelivery(w, r)
+	if !ok {
+		return
+	}
+
+	attempts := []models.WebhookAttempt{}
+	if err := dbFor(r).Where("delivery_id = ?", delivery.ID).Order("id").Find(&attempts).Error; err != nil {
+		dbError(w, r, err, "Failed to fetch delivery attempts")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		models.WebhookDelivery
+		AttemptLog []models.WebhookAttempt `json:"attempt_log"`
+	}{*delivery, attempts})
+}
+
+// RedeliverWebhookHandler queues a delivery to be sent again right away
+func RedeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	delivery, ok := lookupDelivery(w, r)
+	if !ok {
+		return
+	}
+	if err := webhooks.Redeliver(dbFor(r), delivery.ID); err != nil {
+		dbError(w, r, err, "Failed to redeliver webhook")
+		return
+	}
+	recordWrite(r)
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte("Delivery queued\n"))
+}
+
+func validWebhookEvent(e string) bool {
+	for _, t := range webhookEventTypes {
+		if string(t) == e {
+			return true
+		}
+	}
+	return false
+}
+
+func lookupWebhook(w http.ResponseWriter, r *http.Request) (*models.WebhookSubscription, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var sub models.WebhookSubscription
+	if err := dbFor(r).First(&sub, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+		} else {
+			dbError(w, r, err, "Failed to fetch webhook")
+		}
+		return nil, false
+	}
+	return &sub, true
+}
+
+// lookupDelivery loads the delivery named by {deliveryID}, which must
+// belong to the subscription named by {id}
+func lookupDelivery(w http.ResponseWriter, r *http.Request) (*models.WebhookDelivery, bool) {
+	sub, ok := lookupWebhook(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	id, err := strconv.ParseUint(mux.Vars(r)["deliveryID"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var delivery models.WebhookDelivery
+	if err := dbFor(r).Where("subscription_id = ?", sub.ID).First(&delivery, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Delivery not found", http.StatusNotFound)
+		} else {
+			dbError(w, r, err, "Failed to fetch delivery")
+		}
+		return nil, false
+	}
+	return &delivery, true
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"student-server/events"
+	"student-server/logging"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	// MaxSubscriptionsPerConn caps how many topics one WebSocket may follow
+	MaxSubscriptionsPerConn = 20
+
+	// WebSocketPingInterval is how often the server pings idle clients. A
+	// client that doesn't answer within twice this interval is disconnected.
+	WebSocketPingInterval = 30 * time.Second
+
+	upgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+)
+
+const (
+	wsWriteWait      = 10 * time.Second
+	wsMaxMessageSize = 4096
+)
+
+// wsRequest is a message sent by the client
+type wsRequest struct {
+	Action string `json:"action"` // "subscribe" or "unsubscribe"
+	Topic  string `json:"topic"`
+}
+
+// wsMessage is a message sent to the client
+type wsMessage struct {
+	Type   string        `json:"type"` // "subscribed", "unsubscribed", "event" or "error"
+	Topic  string        `json:"topic,omitempty"`
+	Topics []string      `json:"topics,omitempty"`
+	Event  *events.Event `json:"event,omitempty"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// topic matches student events. Supported forms are "students" (every
+// event), "students.id=<id>" and "students.grade=<grade>".
+type topic struct {
+	name  string
+	field string
+	value string
+}
+
+func parseTopic(name string) (topic, error) {
+	if name == "students" {
+		return topic{name: name}, nil
+	}
+
+	rest, ok := strings.CutPrefix(name, "students.")
+	if !ok {
+		return topic{}, fmt.Errorf("unknown topic %q", name)
+	}
+	field, value, ok := strings.Cut(rest, "=")
+	if !ok || value == "" {
+		return topic{}, fmt.Errorf("invalid topic %q", name)
+	}
+
+	switch field {
+	case "id":
+		if _, err := strconv.ParseUint(value, 10, 64); err != nil {
+			return topic{}, fmt.Errorf("invalid student ID in topic %q", name)
+		}
+	case "grade":
+	default:
+		return topic{}, fmt.Errorf("cannot filter on %q", field)
+	}
+	return topic{name: name, field: field, value: value}, nil
+}
+
+func (t topic) matches(e events.Event) bool {
+	switch t.field {
+	case "id":
+		return strconv.FormatUint(uint64(e.Student.ID), 10) == t.value
+	case "grade":
+		return e.Student.Grade == t.value
+	}
+	return true
+}
+
+// topicSet is the set of topics a connection follows
+type topicSet struct {
+	mu     sync.Mutex
+	topics map[string]topic
+}
+
+func (s *topicSet) matching(e events.Event) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var names []string
+	for _, t := range s.topics {
+		if t.matches(e) {
+			names = append(names, t.name)
+		}
+	}
+	return names
+}
+
+// WebSocketHandler upgrades the connection and lets the client subscribe
+// to student change topics by sending {"action": "subscribe", "topic": ...}
+func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already written an error response
+		return
+	}
+	webSockets.Add(1)
+	defer webSockets.Done()
+	defer conn.Close()
+
+	sub, _, _ := broker.Subscribe(0, EventBufferSize)
+	defer broker.Unsubscribe(sub)
+
+	topics := &topicSet{topics: map[string]topic{}}
+	replies := make(chan wsMessage, 8)
+	done := make(chan struct{})
+	quit := make(chan struct{})
+	defer close(quit)
+
+	go readWebSocket(conn, topics, replies, done, quit)
+
+	ping := time.NewTicker(WebSocketPingInterval)
+	defer ping.Stop()
+	closing := closingStreams()
+
+	// All writes happen on this goroutine, as gorilla/websocket requires
+	for {
+		var msg wsMessage
+		select {
+		case <-done:
+			return
+		case <-r.Context().Done():
+			return
+		case <-closing:
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+				time.Now().Add(wsWriteWait))
+			return
+		case msg = <-replies:
+		case e, ok := <-sub.C:
+			if !ok {
+				logging.FromContext(r.Context()).Warn("websocket client fell behind, disconnecting")
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "client too slow"),
+					time.Now().Add(wsWriteWait))
+				return
+			}
+			names := topics.matching(e)
+			if len(names) == 0 {
+				continue
+			}
+			msg = wsMessage{Type: "event", Topics: names, Event: &e}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+			continue
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		if err := conn.WriteJSON(msg); err != nil {
+			return
+		}
+	}
+}
+
+// readWebSocket handles subscribe/unsubscribe requests until the
+// connection fails, then closes done. quit is closed when the writer stops.
+func readWebSocket(conn *websocket.Conn, topics *topicSet, replies chan<- wsMessage, done chan<- struct{}, quit <-chan struct{}) {
+	defer close(done)
+
+	pongWait := 2 * WebSocketPingInterval
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		reply := wsMessage{Type: "error", Error: "invalid message"}
+		var req wsRequest
+		if err := json.Unmarshal(data, &req); err == nil {
+			reply = handleWebSocketRequest(req, topics)
+		}
+
+		select {
+		case replies <- reply:
+		case <-quit:
+			return
+		}
+	}
+}
+
+func handleWebSocketRequest(req wsRequest, topics *topicSet) wsMessage {
+	topics.mu.Lock()
+	defer topics.mu.Unlock()
+
+	switch req.Action {
+	case "subscribe":
+		t, err := parseTopic(req.Topic)
+		if err != nil {
+			return wsMessage{Type: "error", Topic: req.Topic, Error: err.Error()}
+		}
+		if _, exists := topics.topics[t.name]; !exists && len(topics.topics) >= MaxSubscriptionsPerConn {
+			return wsMessage{Type: "error", Topic: req.Topic,
+				Error: fmt.Sprintf("subscription limit of %d reached", MaxSubscriptionsPerConn)}
+		}
+		topics.topics[t.name] = t
+		return wsMessage{Type: "subscribed", Topic: t.name}
+	case "unsubscribe":
+		if _, exists := topics.topics[req.Topic]; !exists {
+			return wsMessage{Type: "error", Topic: req.Topic, Error: "not subscribed"}
+		}
+		delete(topics.topics, req.Topic)
+		return wsMessage{Type: "unsubscribed", Topic: req.Topic}
+	}
+	return wsMessage{Type: "error", Error: fmt.Sprintf("unknown action %q", req.Action)}
+}
@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// GormLogger sends GORM's logs to the logger in each statement's context,
+// so they carry the request ID of the request that ran them. Failed
+// statements are logged at error level, slow ones at warn level and the
+// rest at debug level.
+type GormLogger struct {
+	SlowThreshold time.Duration
+	level         gormlogger.LogLevel
+}
+
+// NewGormLogger returns a GORM logger that reports statements slower than
+// slowThreshold
+func NewGormLogger(slowThreshold time.Duration) *GormLogger {
+	return &GormLogger{SlowThreshold: slowThreshold, level: gormlogger.Info}
+}
+
+// LogMode returns a copy of l that logs at the given GORM level
+func (l *GormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	clone := *l
+	clone.level = level
+	return &clone
+}
+
+func (l *GormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Info {
+		FromContext(ctx).InfoContext(ctx, msg, "args", args)
+	}
+}
+
+func (l *GormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Warn {
+		FromContext(ctx).WarnContext(ctx, msg, "args", args)
+	}
+}
+
+func (l *GormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Error {
+		FromContext(ctx).ErrorContext(ctx, msg, "args", args)
+	}
+}
+
+func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.level <= gormlogger.Silent {
+		return
+	}
+	logger := FromContext(ctx)
+	elapsed := time.Since(begin)
+
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.level >= gormlogger.Error:
+		sql, rows := fc()
+		logger.ErrorContext(ctx, "query failed", "sql", sql, "rows", rows, "duration_ms", elapsed.Milliseconds(), "error", err)
+	case l.SlowThreshold > 0 && elapsed > l.SlowThreshold && l.level >= gormlogger.Warn:
+		sql, rows := fc()
+		logger.WarnContext(ctx, "slow query", "sql", sql, "rows", rows, "duration_ms", elapsed.Milliseconds())
+	case l.level >= gormlogger.Info && logger.Enabled(ctx, slog.LevelDebug):
+		sql, rows := fc()
+		logger.DebugContext(ctx, "query", "sql", sql, "rows", rows, "duration_ms", elapsed.Milliseconds())
+	}
+}
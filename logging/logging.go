@@ -0,0 +1,143 @@
+// Package logging sets up the server's structured logger and carries a
+// request-scoped logger in contexts
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Output formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Config describes how log records are written
+type Config struct {
+	Format string `yaml:"format" toml:"format"` // FormatText or FormatJSON
+	Level  string `yaml:"level" toml:"level"`   // debug, info, warn or error
+}
+
+// DefaultConfig returns text output at info level
+func DefaultConfig() Config {
+	return Config{Format: FormatText, Level: "info"}
+}
+
+// New returns a logger writing to w as described by cfg
+func New(w io.Writer, cfg Config) (*slog.Logger, error) {
+	level, err := parseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	return newLogger(w, cfg.Format, level)
+}
+
+// level is the minimum level of the logger installed by Setup; SetLevel
+// changes it while the server runs
+var level slog.LevelVar
+
+// Setup makes a logger for cfg the default, which also sends output from
+// the standard log package through it
+func Setup(w io.Writer, cfg Config) error {
+	l, err := parseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+	logger, err := newLogger(w, cfg.Format, &level)
+	if err != nil {
+		return err
+	}
+	level.Set(l)
+	slog.SetDefault(logger)
+	return nil
+}
+
+// SetLevel changes the minimum level of the logger installed by Setup
+func SetLevel(name string) error {
+	l, err := parseLevel(name)
+	if err != nil {
+		return err
+	}
+	level.Set(l)
+	return nil
+}
+
+func parseLevel(name string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return l, fmt.Errorf("invalid log level %q (want debug, info, warn or error)", name)
+	}
+	return l, nil
+}
+
+func newLogger(w io.Writer, format string, level slog.Leveler) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+
+	switch strings.ToLower(format) {
+	case FormatText, "":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q (want text or json)", format)
+	}
+}
+
+type loggerKey struct{}
+type requestKey struct{}
+
+// request holds what is learned about a request while it is handled, so
+// middleware that runs before authentication can still log the principal
+type request struct {
+	id        string
+	principal string
+}
+
+// WithLogger returns a copy of ctx carrying logger
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// WithRequestID returns a copy of ctx for the request with the given ID.
+// Its logger includes the ID in every record.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, requestKey{}, &request{id: id})
+	return WithLogger(ctx, FromContext(ctx).With("request_id", id))
+}
+
+// RequestID returns the ID of the request ctx belongs to, if any
+func RequestID(ctx context.Context) string {
+	if req, ok := ctx.Value(requestKey{}).(*request); ok {
+		return req.id
+	}
+	return ""
+}
+
+// WithPrincipal records the authenticated user of the request ctx belongs
+// to and returns a copy of ctx whose logger includes it
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	if req, ok := ctx.Value(requestKey{}).(*request); ok {
+		req.principal = principal
+	}
+	return WithLogger(ctx, FromContext(ctx).With("user", principal))
+}
+
+// Principal returns the user recorded with WithPrincipal, if any
+func Principal(ctx context.Context) string {
+	if req, ok := ctx.Value(requestKey{}).(*request); ok {
+		return req.principal
+	}
+	return ""
+}
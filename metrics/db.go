@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
+)
+
+const startKey = "metrics:start"
+
+// InstrumentDB times every statement run through db with GORM callbacks
+// and exports its connection pool statistics labelled with name
+func InstrumentDB(db *gorm.DB, name string) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	stats := collectors.NewDBStatsCollector(sqlDB, name)
+	if err := Registry.Register(stats); err != nil {
+		// A reconnected database replaces the pool registered under its name
+		var registered prometheus.AlreadyRegisteredError
+		if !errors.As(err, &registered) {
+			return err
+		}
+		Registry.Unregister(registered.ExistingCollector)
+		if err := Registry.Register(stats); err != nil {
+			return err
+		}
+	}
+
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("metrics:before_create", startTimer),
+		cb.Create().After("gorm:create").Register("metrics:after_create", observe("create")),
+		cb.Query().Before("gorm:query").Register("metrics:before_query", startTimer),
+		cb.Query().After("gorm:query").Register("metrics:after_query", observe("query")),
+		cb.Update().Before("gorm:update").Register("metrics:before_update", startTimer),
+		cb.Update().After("gorm:update").Register("metrics:after_update", observe("update")),
+		cb.Delete().Before("gorm:delete").Register("metrics:before_delete", startTimer),
+		cb.Delete().After("gorm:delete").Register("metrics:after_delete", observe("delete")),
+		cb.Row().Before("gorm:row").Register("metrics:before_row", startTimer),
+		cb.Row().After("gorm:row").Register("metrics:after_row", observe("row")),
+		cb.Raw().Before("gorm:raw").Register("metrics:before_raw", startTimer),
+		cb.Raw().After("gorm:raw").Register("metrics:after_raw", observe("raw")),
+	)
+}
+
+func startTimer(tx *gorm.DB) {
+	tx.InstanceSet(startKey, time.Now())
+}
+
+func observe(operation string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		value, ok := tx.InstanceGet(startKey)
+		if !ok {
+			return
+		}
+		table := tx.Statement.Table
+		if table == "" {
+			table = "unknown"
+		}
+		QueryDuration.WithLabelValues(operation, table).Observe(time.Since(value.(time.Time)).Seconds())
+		if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			QueryErrors.WithLabelValues(operation, table).Inc()
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor records gRPC call counts and durations by full
+// method name and status code
+func UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	observeRPC(info.FullMethod, err, start)
+	return resp, err
+}
+
+// StreamServerInterceptor is the streaming counterpart of UnaryServerInterceptor
+func StreamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	observeRPC(info.FullMethod, err, start)
+	return err
+}
+
+func observeRPC(method string, err error, start time.Time) {
+	labels := []string{method, status.Code(err).String()}
+	RPCsTotal.WithLabelValues(labels...).Inc()
+	RPCDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+}
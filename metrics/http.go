@@ -0,0 +1,27 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"student-server/middleware"
+)
+
+// Middleware records request counts, durations and in-flight requests.
+// Requests are labelled with the mux route template (e.g. /students/{id})
+// rather than the path, so IDs don't create a series each.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		RequestsInFlight.Inc()
+		defer RequestsInFlight.Dec()
+
+		start := time.Now()
+		rec := middleware.NewStatusRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		labels := []string{middleware.RouteTemplate(r), r.Method, strconv.Itoa(rec.Status)}
+		RequestsTotal.WithLabelValues(labels...).Inc()
+		RequestDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,105 @@
+// Package metrics collects the server's Prometheus metrics and serves them
+// on /metrics
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every metric the server exports. It is separate from the
+// Prometheus default registry so tests can read it without side effects
+// from other packages.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// RequestsTotal counts finished HTTP requests by route template, method and status
+	RequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled, by route template, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	// RequestDuration observes how long HTTP requests took to handle
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time spent handling HTTP requests, by route template, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	// RequestsInFlight is the number of HTTP requests being handled
+	RequestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests currently being handled.",
+	})
+
+	// RPCsTotal counts finished gRPC calls by full method name and status code
+	RPCsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_handled_total",
+		Help: "gRPC calls handled, by full method name and status code.",
+	}, []string{"method", "code"})
+
+	// RPCDuration observes how long gRPC calls took, streams included
+	RPCDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_handling_seconds",
+		Help:    "Time spent handling gRPC calls, by full method name and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "code"})
+
+	// AuthFailures counts rejected credentials by transport (http or grpc)
+	// and reason (missing or invalid)
+	AuthFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_failures_total",
+		Help: "Requests rejected for missing or invalid credentials.",
+	}, []string{"transport", "reason"})
+
+	// RateLimited counts requests refused for exceeding a rate limit, by
+	// route group
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rate_limited_requests_total",
+		Help: "Requests refused with 429 for exceeding a rate limit, by route group.",
+	}, []string{"group"})
+
+	// CacheRequests counts cache lookups by cache and result (hit or miss)
+	CacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_requests_total",
+		Help: "Cache lookups, by cache and result (hit or miss).",
+	}, []string{"cache", "result"})
+
+	// QueryDuration observes database statements by operation and table
+	QueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "Time spent running database statements, by operation and table.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"operation", "table"})
+
+	// QueryErrors counts failed database statements by operation and table
+	QueryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_query_errors_total",
+		Help: "Database statements that returned an error, by operation and table.",
+	}, []string{"operation", "table"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		RequestsTotal,
+		RequestDuration,
+		RequestsInFlight,
+		RPCsTotal,
+		RPCDuration,
+		AuthFailures,
+		RateLimited,
+		CacheRequests,
+		QueryDuration,
+		QueryErrors,
+	)
+}
+
+// Handler serves the registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,239 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gorilla/mux"
+	"github.com/klauspost/compress/zstd"
+)
+
+// encoder is a compressor that can be reused for another response
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// encodings are the supported content codings, most preferred first
+var encodings = []string{"zstd", "br", "gzip"}
+
+var encoders = map[string]*sync.Pool{
+	"zstd": {New: func() any {
+		// A single goroutine suits small responses; the window fits what
+		// browsers accept
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(1<<20))
+		return enc
+	}},
+	"br": {New: func() any {
+		return brotli.NewWriterLevel(nil, 4)
+	}},
+	"gzip": {New: func() any {
+		return gzip.NewWriter(nil)
+	}},
+}
+
+// Compress compresses responses of at least minSize bytes with the best
+// encoding the client accepts: zstd, brotli or gzip. Event streams,
+// WebSockets and already encoded or binary responses are left alone.
+func Compress(minSize int) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: minSize, status: http.StatusOK}
+			defer cw.close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding picks the encoding with the highest quality in an
+// Accept-Encoding header, preferring encodings earlier in encodings on a
+// tie. It returns "" if none is acceptable.
+func negotiateEncoding(header string) string {
+	quality := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				q = 0
+			}
+		}
+		quality[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range encodings {
+		q, ok := quality[encoding]
+		if !ok {
+			q = quality["*"]
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// compressible reports whether responses of contentType are worth
+// compressing. Event streams are excluded as they must reach the client
+// event by event.
+func compressible(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "text/event-stream":
+		return false
+	case strings.HasPrefix(mediaType, "text/"),
+		mediaType == "application/json",
+		mediaType == "application/javascript",
+		mediaType == "application/xml",
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	return false
+}
+
+// compressWriter holds the start of the response back until it knows
+// whether the response is big enough to compress
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status      int
+	wroteHeader bool
+	buf         []byte
+	decided     bool
+	enc         encoder
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.wroteHeader || w.decided {
+		return
+	}
+	if status < 200 {
+		w.ResponseWriter.WriteHeader(status) // informational responses go out as they are
+		return
+	}
+	w.status, w.wroteHeader = status, true
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		w.decide()
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.minSize {
+			return len(b), nil
+		}
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.enc != nil {
+		return w.enc.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// decide sends the header, compressing the response if it is big enough
+// and of a compressible type, and writes what was held back
+func (w *compressWriter) decide() error {
+	w.decided = true
+	h := w.ResponseWriter.Header()
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+		// Sniff now, as net/http would only see compressed bytes
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	if len(w.buf) >= w.minSize && len(w.buf) > 0 && h.Get("Content-Encoding") == "" &&
+		w.status != http.StatusNoContent && w.status != http.StatusNotModified && w.status != http.StatusPartialContent &&
+		compressible(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		w.enc = encoders[w.encoding].Get().(encoder)
+		w.enc.Reset(w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush sends what has been written so far, compressing it if the
+// response qualifies by then
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide()
+	}
+	if w.enc != nil {
+		w.enc.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("hijacking not supported")
+	}
+	w.decided = true
+	return hijacker.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close finishes the response once the handler has returned
+func (w *compressWriter) close() {
+	if !w.decided {
+		if !w.wroteHeader {
+			return // nothing written; net/http sends an empty 200
+		}
+		w.decide()
+	}
+	if w.enc != nil {
+		w.enc.Close()
+		w.enc.Reset(nil)
+		encoders[w.encoding].Put(w.enc)
+		w.enc = nil
+	}
+}
@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// CORSConfig is the cross-origin policy for browsers. CORS is off while
+// AllowedOrigins is empty.
+type CORSConfig struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins" toml:"allowed_origins"` // "https://app.example.com", "https://*.example.com" or "*"
+	AllowedMethods   []string      `yaml:"allowed_methods" toml:"allowed_methods"`
+	AllowedHeaders   []string      `yaml:"allowed_headers" toml:"allowed_headers"` // "*" allows any
+	ExposedHeaders   []string      `yaml:"exposed_headers" toml:"exposed_headers"`
+	AllowCredentials bool          `yaml:"allow_credentials" toml:"allow_credentials"`
+	MaxAge           time.Duration `yaml:"max_age" toml:"max_age"` // how long browsers may cache a preflight answer
+}
+
+// DefaultCORSConfig returns a policy that allows the API's methods and
+// headers once origins are added
+func DefaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE"},
+		AllowedHeaders: []string{"Authorization", "Content-Type", "Last-Event-ID", RequestIDHeader},
+		ExposedHeaders: []string{RequestIDHeader, "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
+		MaxAge:         10 * time.Minute,
+	}
+}
+
+// Validate reports settings that can't work
+func (c CORSConfig) Validate() error {
+	var errs []error
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			if c.AllowCredentials {
+				errs = append(errs, errors.New(`allowed_origins "*" can't be combined with allow_credentials`))
+			}
+			continue
+		}
+		u, err := url.Parse(strings.Replace(origin, "*.", "wildcard.", 1))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || strings.Count(origin, "*") > 1 ||
+			strings.Contains(origin, "*") && !strings.Contains(origin, "://*.") {
+			errs = append(errs, fmt.Errorf("allowed origin %q is not a scheme and host like https://app.example.com or https://*.example.com", origin))
+		}
+	}
+	if c.MaxAge < 0 {
+		errs = append(errs, errors.New("max_age must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// allowsOrigin reports whether a request from origin is allowed
+func (c CORSConfig) allowsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, allowed := range c.AllowedOrigins {
+		allowed = strings.ToLower(allowed)
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		// "https://*.example.com" matches subdomains at any depth, but not
+		// example.com itself
+		if prefix, suffix, ok := strings.Cut(allowed, "*"); ok &&
+			len(origin) > len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c CORSConfig) allowsMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "POST": // always allowed by browsers
+		return true
+	}
+	return slices.Contains(c.AllowedMethods, method)
+}
+
+func (c CORSConfig) allowsHeaders(requested string) bool {
+	if slices.Contains(c.AllowedHeaders, "*") {
+		return true
+	}
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.TrimSpace(header)
+		if header != "" && !slices.ContainsFunc(c.AllowedHeaders, func(allowed string) bool { return strings.EqualFold(allowed, header) }) {
+			return false
+		}
+	}
+	return true
+}
+
+var corsPolicy atomic.Pointer[CORSConfig]
+
+func init() {
+	corsPolicy.Store(&CORSConfig{})
+}
+
+// SetCORSPolicy replaces the policy CORS enforces. It is safe to call while
+// requests are being served.
+func SetCORSPolicy(c CORSConfig) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	c.AllowedOrigins = slices.Clone(c.AllowedOrigins)
+	corsPolicy.Store(&c)
+	return nil
+}
+
+// CORS lets browsers on the allowed origins call the API. It answers
+// preflight requests itself, so it must run before authentication, which
+// browsers don't send with a preflight.
+func CORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := corsPolicy.Load()
+		if len(c.AllowedOrigins) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Caches must keep responses to each origin apart
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+		}
+		if !c.allowsOrigin(origin) {
+			if preflight {
+				http.Error(w, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+			// The browser withholds the response without CORS headers
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if slices.Contains(c.AllowedOrigins, "*") {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if c.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if len(c.ExposedHeaders) > 0 {
+				h.Set("Access-Control-Expose-Headers", strings.Join(c.ExposedHeaders, ", "))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		method := r.Header.Get("Access-Control-Request-Method")
+		requested := r.Header.Get("Access-Control-Request-Headers")
+		if !c.allowsMethod(method) || !c.allowsHeaders(requested) {
+			http.Error(w, "Method or headers not allowed", http.StatusForbidden)
+			return
+		}
+		h.Set("Access-Control-Allow-Methods", strings.Join(c.AllowedMethods, ", "))
+		if requested != "" {
+			// Echoing the request covers "*", which browsers don't honour
+			// for Authorization
+			h.Set("Access-Control-Allow-Headers", requested)
+		}
+		if c.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
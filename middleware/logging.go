@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"student-server/logging"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the request ID in requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID gives every request an ID: the client's X-Request-ID if it sent
+// a usable one, otherwise a new random one. The ID is echoed in the
+// response and included in everything logged through the request context.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := UsableRequestID(r.Header.Get(RequestIDHeader))
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := logging.WithRequestID(r.Context(), id)
+		if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+			ctx = logging.WithLogger(ctx, logging.FromContext(ctx).With("trace_id", span.TraceID().String()))
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// UsableRequestID returns id if the client sent a usable one, otherwise a
+// new random ID
+func UsableRequestID(id string) string {
+	if validRequestID(id) {
+		return id
+	}
+	return newRequestID()
+}
+
+// validRequestID accepts IDs of up to 128 printable ASCII characters, so a
+// client can't inject line breaks or huge values into the logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// AccessLog writes one log record per request once it has been handled.
+// Server errors are logged at error level, everything else at info level.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := NewStatusRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		level := slog.LevelInfo
+		if rec.Status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("route", RouteTemplate(r)),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.Status),
+			slog.Int64("bytes", rec.Bytes),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("remote_addr", r.RemoteAddr),
+		}
+		if principal := logging.Principal(r.Context()); principal != "" {
+			attrs = append(attrs, slog.String("user", principal))
+		}
+		logging.FromContext(r.Context()).LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+// Chain wraps h in middlewares, the first one outermost. It is used for
+// handlers mux calls without its middleware, such as NotFoundHandler.
+func Chain(h http.Handler, middlewares ...mux.MiddlewareFunc) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
@@ -0,0 +1,74 @@
+// Package middleware holds HTTP middleware shared by the server's routes
+package middleware
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// StatusRecorder remembers the status code and body size written through
+// it. It passes flushing and hijacking through so event streams and
+// WebSockets keep working behind it.
+type StatusRecorder struct {
+	http.ResponseWriter
+	Status int
+	Bytes  int64
+
+	wroteHeader bool
+}
+
+// NewStatusRecorder wraps w; the status is 200 until something else is written
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (w *StatusRecorder) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.Status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *StatusRecorder) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.Bytes += int64(n)
+	return n, err
+}
+
+func (w *StatusRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wroteHeader = true
+		flusher.Flush()
+	}
+}
+
+func (w *StatusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("hijacking not supported")
+	}
+	w.Status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *StatusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// RouteTemplate returns the template of the mux route that matched r, e.g.
+// /students/{id}, or "unmatched"
+func RouteTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "unmatched"
+}
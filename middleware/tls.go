@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// HSTS tells browsers to use HTTPS only for maxAge, including on
+// subdomains. The header is only sent on TLS connections, as browsers
+// ignore it over plain HTTP.
+func HSTS(maxAge time.Duration) mux.MiddlewareFunc {
+	value := fmt.Sprintf("max-age=%d; includeSubDomains", int64(maxAge.Seconds()))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS != nil {
+				w.Header().Set("Strict-Transport-Security", value)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RedirectHTTPS redirects every request to the same URL over HTTPS on
+// httpsPort. Nothing else is served on plain HTTP, so credentials are never
+// accepted unencrypted.
+func RedirectHTTPS(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = strings.Trim(r.Host, "[]") // no port; IPv6 hosts are bracketed
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		// 308 keeps the method and body, unlike 301
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// OutboxEvent is a change event written in the same transaction as the
+// change itself, waiting to be published by the outbox relay. It counts as
+// published once every sink has accepted it.
+type OutboxEvent struct {
+	ID          uint       `json:"id" gorm:"primarykey"`
+	EventType   string     `json:"event_type" gorm:"type:varchar(50);not null"`
+	Payload     string     `json:"payload" gorm:"type:text;not null"`
+	CreatedAt   time.Time  `json:"created_at"`
+	PublishedAt *time.Time `json:"published_at" gorm:"index"`
+	Attempts    int        `json:"attempts" gorm:"not null;default:0"`
+	LastError   string     `json:"last_error" gorm:"type:text"`
+	// TraceParent is the W3C traceparent of the write, so publishing
+	// continues its trace
+	TraceParent string `json:"trace_parent,omitempty" gorm:"type:varchar(55);not null;default:''"`
+}
+
+func (OutboxEvent) TableName() string {
+	return "outbox"
+}
+
+// OutboxDelivery tracks one sink's progress with an outbox event. An event
+// a sink keeps rejecting is parked: the sink moves on without it and the
+// row stays here, with its last error, for someone to look into.
+type OutboxDelivery struct {
+	EventID     uint       `json:"event_id" gorm:"primaryKey;autoIncrement:false"`
+	Sink        string     `json:"sink" gorm:"primaryKey;type:varchar(50)"`
+	Attempts    int        `json:"attempts" gorm:"not null;default:0"`
+	LastError   string     `json:"last_error" gorm:"type:text"`
+	DeliveredAt *time.Time `json:"delivered_at"`
+	ParkedAt    *time.Time `json:"parked_at" gorm:"index"`
+}
+
+func (OutboxDelivery) TableName() string {
+	return "outbox_deliveries"
+}
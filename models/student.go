@@ -1,6 +1,10 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
 
 type Student struct {
 	gorm.Model        // Includes ID, CreatedAt, UpdatedAt, DeletedAt
@@ -12,3 +16,15 @@ type Student struct {
 func (Student) TableName() string {
 	return "students"
 }
+
+// ErrInvalidStudent is returned for a student that can't be stored
+var ErrInvalidStudent = errors.New("name and grade are required and age must be positive")
+
+// Validate reports whether s can be stored. Every write goes through it,
+// whichever API it came from.
+func (s Student) Validate() error {
+	if s.Name == "" || s.Age <= 0 || s.Grade == "" {
+		return ErrInvalidStudent
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Webhook delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryDead      = "dead" // gave up after the maximum number of attempts
+)
+
+// WebhookSubscription is an endpoint that wants to hear about student events
+type WebhookSubscription struct {
+	gorm.Model
+	URL        string `json:"url" gorm:"type:varchar(2048);not null"`
+	EventTypes string `json:"-" gorm:"type:varchar(255);not null"` // comma-separated event types
+	Secret     string `json:"-" gorm:"type:varchar(255);not null"`
+	Active     bool   `json:"active" gorm:"not null;default:true"`
+}
+
+// Events returns the subscribed event types
+func (s WebhookSubscription) Events() []string {
+	return strings.Split(s.EventTypes, ",")
+}
+
+// Wants reports whether the subscription covers eventType
+func (s WebhookSubscription) Wants(eventType string) bool {
+	for _, e := range s.Events() {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is one event queued for one subscription
+type WebhookDelivery struct {
+	ID             uint       `json:"id" gorm:"primarykey"`
+	SubscriptionID uint       `json:"subscription_id" gorm:"index;not null"`
+	EventType      string     `json:"event_type" gorm:"type:varchar(50);not null"`
+	Payload        string     `json:"payload" gorm:"type:text;not null"`
+	Status         string     `json:"status" gorm:"type:varchar(20);index;not null"`
+	Attempts       int        `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"index"`
+	LockedUntil    *time.Time `json:"-"`
+	LastError      string     `json:"last_error" gorm:"type:text"`
+	TraceParent    string     `json:"trace_parent,omitempty" gorm:"type:varchar(55);not null;default:''"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// WebhookAttempt logs a single HTTP attempt of a delivery
+type WebhookAttempt struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	DeliveryID uint      `json:"delivery_id" gorm:"index;not null"`
+	StatusCode int       `json:"status_code"`
+	Error      string    `json:"error" gorm:"type:text"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
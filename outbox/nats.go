@@ -0,0 +1,180 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NATSSink publishes events to a NATS (or NATS-protocol compatible)
+// server. Subjects are "<prefix>.created", "<prefix>.updated" and
+// "<prefix>.deleted". Each publish is followed by a PING so it only
+// succeeds once the server has processed the message, and when the server
+// supports headers a Nats-Msg-Id header lets JetStream drop duplicates.
+type NATSSink struct {
+	URL     string
+	Prefix  string
+	Timeout time.Duration
+
+	mu      sync.Mutex
+	conn    net.Conn
+	reader  *bufio.Reader
+	headers bool
+}
+
+// NewNATSSink creates a sink for the server at rawURL, e.g. nats://localhost:4222
+func NewNATSSink(rawURL, prefix string) *NATSSink {
+	return &NATSSink{URL: rawURL, Prefix: prefix, Timeout: 5 * time.Second}
+}
+
+func (s *NATSSink) Name() string { return "nats" }
+
+// Publish sends msg, connecting first if needed
+func (s *NATSSink) Publish(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		if err := s.connect(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := s.publish(ctx, msg); err != nil {
+		// Drop the connection; the next attempt starts fresh
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+// Close closes the connection to the server
+func (s *NATSSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *NATSSink) subject(msg Message) string {
+	_, action, _ := strings.Cut(string(msg.Type), ".")
+	return s.Prefix + "." + action
+}
+
+func (s *NATSSink) connect(ctx context.Context) error {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+
+	dialer := net.Dialer{Timeout: s.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.reader = bufio.NewReader(conn)
+	s.setDeadline(ctx)
+
+	line, err := s.reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		s.conn = nil
+		return fmt.Errorf("unexpected greeting from NATS server: %q", line)
+	}
+	var info struct {
+		Headers bool `json:"headers"`
+	}
+	json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info)
+	s.headers = info.Headers
+
+	options := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "student-server",
+		"headers":  info.Headers,
+	}
+	if u.User != nil {
+		options["user"] = u.User.Username()
+		options["pass"], _ = u.User.Password()
+	}
+	connect, _ := json.Marshal(options)
+
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", connect); err == nil {
+		err = s.awaitPong()
+	}
+	if err != nil {
+		conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (s *NATSSink) publish(ctx context.Context, msg Message) error {
+	s.setDeadline(ctx)
+
+	var err error
+	if s.headers {
+		hdr := fmt.Sprintf("NATS/1.0\r\nNats-Msg-Id: outbox-%d\r\n", msg.ID)
+		if msg.TraceParent != "" {
+			hdr += "traceparent: " + msg.TraceParent + "\r\n"
+		}
+		hdr += "\r\n"
+		_, err = fmt.Fprintf(s.conn, "HPUB %s %d %d\r\n%s%s\r\nPING\r\n",
+			s.subject(msg), len(hdr), len(hdr)+len(msg.Payload), hdr, msg.Payload)
+	} else {
+		_, err = fmt.Fprintf(s.conn, "PUB %s %d\r\n%s\r\nPING\r\n", s.subject(msg), len(msg.Payload), msg.Payload)
+	}
+	if err != nil {
+		return err
+	}
+	return s.awaitPong()
+}
+
+// awaitPong reads until the server answers our PING, replying to its own
+// PINGs on the way and failing on -ERR
+func (s *NATSSink) awaitPong() error {
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := fmt.Fprint(s.conn, "PONG\r\n"); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New("NATS server error: " + strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+		// +OK and INFO updates need no action
+	}
+}
+
+func (s *NATSSink) setDeadline(ctx context.Context) {
+	deadline := time.Now().Add(s.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	s.conn.SetDeadline(deadline)
+}
@@ -0,0 +1,311 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"student-server/database"
+	"student-server/logging"
+	"student-server/models"
+	"student-server/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Message is a published outbox event
+type Message struct {
+	ID uint // outbox row ID; sinks can use it to drop duplicates
+	database.ChangePayload
+	Payload     []byte // the raw JSON payload
+	TraceParent string // W3C traceparent of the publish span, if traced
+}
+
+// Sink receives published events. Publish must only return nil once the
+// event has been handed off durably; on error the relay retries the event
+// later, so every sink sees each event at least once. Name keys the sink's
+// progress in the database, so it must be unique and stay the same across
+// restarts.
+type Sink interface {
+	Name() string
+	Publish(ctx context.Context, msg Message) error
+}
+
+// errMalformed marks events that can never be published, so they are
+// parked at once instead of retried
+var errMalformed = errors.New("malformed outbox payload")
+
+// Relay hands outbox rows to each of its sinks in ID order. Sinks progress
+// independently: one that fails holds back only its own later events, and
+// is retried after RetryDelay. An event a sink has rejected MaxAttempts
+// times is parked for that sink so the rest can flow. On Postgres each
+// sink is served by one relay in the cluster at a time, so the order holds
+// with several instances too. A row committed after a later ID has been
+// handed over still goes out, just after that one.
+type Relay struct {
+	DB           *gorm.DB
+	Sinks        []Sink
+	PollInterval time.Duration
+	BatchSize    int
+	// RetryDelay is how long Run leaves a sink alone after a failed publish
+	RetryDelay time.Duration
+	// MaxAttempts is how often a sink may reject an event before it is parked
+	MaxAttempts int
+	// Retention is how long published rows are kept before being purged
+	Retention time.Duration
+
+	wake    chan struct{}
+	retryAt map[string]time.Time // by sink name; only touched by Run
+}
+
+// NewRelay creates a relay with default settings
+func NewRelay(db *gorm.DB, sinks ...Sink) *Relay {
+	return &Relay{
+		DB:           db,
+		Sinks:        sinks,
+		PollInterval: time.Second,
+		BatchSize:    100,
+		RetryDelay:   5 * time.Second,
+		MaxAttempts:  10,
+		Retention:    24 * time.Hour,
+		wake:         make(chan struct{}, 1),
+		retryAt:      map[string]time.Time{},
+	}
+}
+
+// Wake makes a running relay check for new events immediately
+func (r *Relay) Wake() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run publishes events until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+	purge := time.NewTicker(time.Hour)
+	defer purge.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-purge.C:
+			r.purge()
+			continue
+		case <-ticker.C:
+		case <-r.wake:
+		}
+
+		for {
+			more, err := r.publishPending(ctx, true)
+			if _, markErr := r.markPublished(ctx); markErr != nil {
+				err = errors.Join(err, markErr)
+			}
+			if err != nil {
+				slog.Error("outbox relay failed to publish", "error", err)
+			}
+			if !more || ctx.Err() != nil {
+				break
+			}
+		}
+	}
+}
+
+// PublishPending hands one batch of pending events to every sink, retrying
+// failed sinks straight away, and returns how many events became
+// published, i.e. accepted by every sink. Each sink stops at the first
+// event it rejects so that its later events are never published ahead of
+// it.
+func (r *Relay) PublishPending(ctx context.Context) (int, error) {
+	_, err := r.publishPending(ctx, false)
+	published, markErr := r.markPublished(ctx)
+	return published, errors.Join(err, markErr)
+}
+
+// publishPending serves one batch to each sink, skipping sinks waiting out
+// RetryDelay if backoff is set. It reports whether a sink filled its batch
+// and so may have more to do.
+func (r *Relay) publishPending(ctx context.Context, backoff bool) (bool, error) {
+	more := false
+	var errs []error
+	for _, sink := range r.Sinks {
+		if backoff && time.Now().Before(r.retryAt[sink.Name()]) {
+			continue
+		}
+		n, err := r.serveSink(ctx, sink)
+		if err != nil {
+			errs = append(errs, err)
+			if backoff {
+				r.retryAt[sink.Name()] = time.Now().Add(r.RetryDelay)
+			}
+			continue
+		}
+		more = more || n == r.BatchSize
+	}
+	return more, errors.Join(errs...)
+}
+
+// serveSink hands sink the next batch of events it hasn't had yet
+func (r *Relay) serveSink(ctx context.Context, sink Sink) (int, error) {
+	db := r.DB.WithContext(ctx)
+	if db.Dialector.Name() != "postgres" {
+		return r.sinkBatch(ctx, db, sink)
+	}
+
+	// The lock lets only one relay in the cluster serve the sink at a
+	// time, keeping its events in order; the others skip it this round
+	var handled int
+	var publishErr error
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var locked bool
+		if err := tx.Raw("SELECT pg_try_advisory_xact_lock(hashtext(?))", "outbox:"+sink.Name()).Scan(&locked).Error; err != nil || !locked {
+			return err
+		}
+		// Commit even when the sink failed, to keep progress and the attempt count
+		handled, publishErr = r.sinkBatch(ctx, tx, sink)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return handled, publishErr
+}
+
+func (r *Relay) sinkBatch(ctx context.Context, db *gorm.DB, sink Sink) (int, error) {
+	var rows []models.OutboxEvent
+	err := db.Where("published_at IS NULL").
+		Where("NOT EXISTS (SELECT 1 FROM outbox_deliveries d WHERE d.event_id = outbox.id AND d.sink = ? AND (d.delivered_at IS NOT NULL OR d.parked_at IS NOT NULL))", sink.Name()).
+		Order("id").Limit(r.BatchSize).Find(&rows).Error
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+
+	ids := make([]uint, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	var failed []models.OutboxDelivery
+	if err := db.Where("sink = ? AND event_id IN ?", sink.Name(), ids).Find(&failed).Error; err != nil {
+		return 0, err
+	}
+	attempts := map[uint]int{}
+	for _, d := range failed {
+		attempts[d.EventID] = d.Attempts
+	}
+
+	for i, row := range rows {
+		now := time.Now()
+		delivery := models.OutboxDelivery{EventID: row.ID, Sink: sink.Name(), Attempts: attempts[row.ID]}
+		publishErr := r.publish(ctx, sink, row)
+		if publishErr == nil {
+			delivery.DeliveredAt = &now
+		} else {
+			delivery.Attempts++
+			delivery.LastError = publishErr.Error()
+			if delivery.Attempts >= r.MaxAttempts || errors.Is(publishErr, errMalformed) {
+				delivery.ParkedAt = &now
+			}
+		}
+		if err := saveDelivery(db, delivery); err != nil {
+			return i, err
+		}
+		if publishErr == nil {
+			continue
+		}
+
+		db.Model(&row).Updates(map[string]interface{}{
+			"attempts":   row.Attempts + 1,
+			"last_error": publishErr.Error(),
+		})
+		if delivery.ParkedAt == nil {
+			return i, publishErr
+		}
+		logging.FromContext(ctx).Error("outbox event parked", "id", row.ID, "sink", sink.Name(), "attempts", delivery.Attempts, "error", publishErr)
+	}
+	return len(rows), nil
+}
+
+func saveDelivery(db *gorm.DB, d models.OutboxDelivery) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "event_id"}, {Name: "sink"}},
+		DoUpdates: clause.AssignmentColumns([]string{"attempts", "last_error", "delivered_at", "parked_at"}),
+	}).Create(&d).Error
+}
+
+// markPublished marks the events every sink has accepted as published and
+// returns how many there were. Events parked for some sink stay
+// unpublished, and so are kept, until they are dealt with.
+func (r *Relay) markPublished(ctx context.Context) (int, error) {
+	names := make([]string, len(r.Sinks))
+	for i, sink := range r.Sinks {
+		names[i] = sink.Name()
+	}
+	query := r.DB.WithContext(ctx).Model(&models.OutboxEvent{}).Where("published_at IS NULL")
+	if len(names) > 0 {
+		query = query.Where("(SELECT COUNT(*) FROM outbox_deliveries d WHERE d.event_id = outbox.id AND d.sink IN ? AND d.delivered_at IS NOT NULL) = ?", names, len(names))
+	}
+	result := query.Update("published_at", time.Now())
+	return int(result.RowsAffected), result.Error
+}
+
+func (r *Relay) publish(ctx context.Context, sink Sink, row models.OutboxEvent) (err error) {
+	// Continue the trace of the request that made the change
+	ctx, span := tracing.Tracer().Start(tracing.ContextWithTraceParent(ctx, row.TraceParent), "outbox.publish "+row.EventType,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.Int64("outbox.id", int64(row.ID)),
+			attribute.String("outbox.sink", sink.Name()),
+		),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	msg, err := decode(row)
+	if err != nil {
+		return err
+	}
+	msg.TraceParent = tracing.TraceParent(ctx)
+	if err := sink.Publish(ctx, msg); err != nil {
+		return fmt.Errorf("sink %s rejected event %d: %w", sink.Name(), row.ID, err)
+	}
+	return nil
+}
+
+// decode turns an outbox row into the message sinks receive
+func decode(row models.OutboxEvent) (Message, error) {
+	msg := Message{ID: row.ID, Payload: []byte(row.Payload)}
+	if err := json.Unmarshal(msg.Payload, &msg.ChangePayload); err != nil {
+		return msg, fmt.Errorf("%w in event %d: %v", errMalformed, row.ID, err)
+	}
+	return msg, nil
+}
+
+func (r *Relay) purge() {
+	cutoff := time.Now().Add(-r.Retention)
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		published := tx.Model(&models.OutboxEvent{}).Select("id").Where("published_at < ?", cutoff)
+		if err := tx.Where("event_id IN (?)", published).Delete(&models.OutboxDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("published_at < ?", cutoff).Delete(&models.OutboxEvent{}).Error
+	})
+	if err != nil {
+		slog.Error("outbox relay failed to purge published events", "error", err)
+	}
+}
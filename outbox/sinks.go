@@ -0,0 +1,29 @@
+package outbox
+
+import (
+	"context"
+
+	"student-server/logging"
+)
+
+// LogSink writes every event to the logger
+type LogSink struct{}
+
+func (LogSink) Name() string { return "log" }
+
+func (LogSink) Publish(ctx context.Context, msg Message) error {
+	logging.FromContext(ctx).InfoContext(ctx, "outbox event", "id", msg.ID, "type", msg.Type, "payload", string(msg.Payload))
+	return nil
+}
+
+// FuncSink adapts a function to the Sink interface
+type FuncSink struct {
+	SinkName string
+	Fn       func(ctx context.Context, msg Message) error
+}
+
+func (s FuncSink) Name() string { return s.SinkName }
+
+func (s FuncSink) Publish(ctx context.Context, msg Message) error {
+	return s.Fn(ctx, msg)
+}
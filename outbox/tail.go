@@ -0,0 +1,174 @@
+package outbox
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"student-server/events"
+	"student-server/models"
+
+	"gorm.io/gorm"
+)
+
+// Tailer follows the outbox by ID and hands every new event to a function
+// in this process, such as the live feed's broker. Unlike the relay, which
+// publishes each event once for the whole cluster, every instance runs its
+// own tailer, so its subscribers see changes made through any instance.
+type Tailer struct {
+	DB           *gorm.DB
+	Handle       func(ctx context.Context, msg Message)
+	PollInterval time.Duration
+	BatchSize    int
+	// GapTimeout is how long a missing ID is waited for. IDs are taken
+	// when a write starts, so a lower one can commit after a higher one,
+	// while a rolled back write leaves a gap forever.
+	GapTimeout time.Duration
+
+	wake     chan struct{}
+	cursor   uint          // every event up to here has been handled or given up on
+	seen     map[uint]bool // events above cursor already handled
+	gapSince time.Time     // when the gap above cursor was first seen
+}
+
+// NewTailer creates a tailer that passes events to handle, starting from
+// the first event in the outbox
+func NewTailer(db *gorm.DB, handle func(ctx context.Context, msg Message)) *Tailer {
+	return &Tailer{
+		DB:           db,
+		Handle:       handle,
+		PollInterval: time.Second,
+		BatchSize:    100,
+		GapTimeout:   10 * time.Second,
+		wake:         make(chan struct{}, 1),
+		seen:         map[uint]bool{},
+	}
+}
+
+// Wake makes a running tailer check for new events immediately
+func (t *Tailer) Wake() {
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run hands over events written from now on until ctx is cancelled
+func (t *Tailer) Run(ctx context.Context) {
+	var last uint
+	if err := t.DB.WithContext(ctx).Model(&models.OutboxEvent{}).Select("COALESCE(MAX(id), 0)").Scan(&last).Error; err != nil {
+		slog.Error("outbox tailer failed to find the latest event", "error", err)
+	}
+	t.cursor = last
+
+	ticker := time.NewTicker(t.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-t.wake:
+		}
+
+		for {
+			n, err := t.Poll(ctx)
+			if err != nil {
+				slog.Error("outbox tailer failed to read events", "error", err)
+			}
+			if n == 0 || ctx.Err() != nil {
+				break
+			}
+		}
+	}
+}
+
+// Poll hands over the events written since the last poll, in ID order,
+// and returns how many there were
+func (t *Tailer) Poll(ctx context.Context) (int, error) {
+	var rows []models.OutboxEvent
+	err := t.DB.WithContext(ctx).Where("id > ?", t.cursor).Order("id").Limit(t.BatchSize).Find(&rows).Error
+	if err != nil {
+		return 0, err
+	}
+
+	handled := 0
+	for _, row := range rows {
+		if t.seen[row.ID] {
+			continue
+		}
+		t.seen[row.ID] = true
+		handled++
+		msg, err := decode(row)
+		if err != nil {
+			slog.Error("outbox tailer skipped an event", "error", err)
+			continue
+		}
+		t.Handle(ctx, msg)
+	}
+	t.advance()
+	return handled, nil
+}
+
+// advance moves the cursor past the events handled in a row. A gap that
+// outlasts GapTimeout is given up on, and the next one waited for.
+func (t *Tailer) advance() {
+	for t.seen[t.cursor+1] {
+		delete(t.seen, t.cursor+1)
+		t.cursor++
+	}
+	if len(t.seen) == 0 {
+		t.gapSince = time.Time{}
+		return
+	}
+	if t.gapSince.IsZero() {
+		t.gapSince = time.Now()
+	}
+	if time.Since(t.gapSince) >= t.GapTimeout {
+		lowest := t.cursor
+		for id := range t.seen {
+			if lowest == t.cursor || id < lowest {
+				lowest = id
+			}
+		}
+		t.cursor = lowest - 1
+		t.gapSince = time.Time{}
+		t.advance()
+	}
+}
+
+// Event returns msg as an event for the live feed, under its outbox ID
+func (msg Message) Event() events.Event {
+	return events.Event{ID: uint64(msg.ID), Type: msg.Type, Student: msg.Student, Time: msg.Time.UTC()}
+}
+
+// Backlog returns an events.Broker Backlog that replays events from the
+// outbox in ID order. The replay is complete only while the client's last
+// event is still in the outbox: published rows are purged after the
+// relay's Retention, and an ID that isn't there was never issued.
+func Backlog(db *gorm.DB) func(ctx context.Context, after uint64, limit int) ([]events.Event, bool, error) {
+	return func(ctx context.Context, after uint64, limit int) ([]events.Event, bool, error) {
+		var last int64
+		if err := db.WithContext(ctx).Model(&models.OutboxEvent{}).Where("id = ?", after).Count(&last).Error; err != nil || last == 0 {
+			return nil, false, err
+		}
+
+		var rows []models.OutboxEvent
+		if err := db.WithContext(ctx).Where("id > ?", after).Order("id").Limit(limit + 1).Find(&rows).Error; err != nil {
+			return nil, false, err
+		}
+		if len(rows) > limit {
+			return nil, false, nil
+		}
+		backlog := make([]events.Event, 0, len(rows))
+		for _, row := range rows {
+			msg, err := decode(row)
+			if err != nil {
+				slog.Error("outbox backlog skipped an event", "error", err)
+				continue
+			}
+			backlog = append(backlog, msg.Event())
+		}
+		return backlog, true, nil
+	}
+}
@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+
+	"student-server/auth"
+	"student-server/logging"
+	"student-server/metrics"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// AllowRPC spends a token of the caller's bucket in group for a gRPC call.
+// Calls count by the authenticated user, else by the peer's address, and
+// fail with ResourceExhausted over the limit.
+func (l *Limiter) AllowRPC(ctx context.Context, group string) error {
+	s := l.settings.Load()
+	limit := s.limit(group)
+	if !s.Enabled || limit.Unlimited() {
+		return nil
+	}
+
+	result, err := l.store.Take(ctx, group+"|"+peerKey(ctx, limit.Key), limit)
+	if err != nil {
+		logging.FromContext(ctx).Warn("rate limit store failed, allowing call", "error", err)
+		return nil
+	}
+	if !result.Allowed {
+		metrics.RateLimited.WithLabelValues(group).Inc()
+		return status.Errorf(codes.ResourceExhausted, "too many requests, retry in %ss", ceilSeconds(result.RetryAfter))
+	}
+	return nil
+}
+
+// peerKey is what a gRPC call is counted by. Calls carry no API key the
+// server could trust, so those limits count by principal.
+func peerKey(ctx context.Context, key string) string {
+	if key != KeyIP {
+		if user, ok := auth.UserFromContext(ctx); ok {
+			return "user:" + user
+		}
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "ip:unknown"
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+	return "ip:" + host
+}
@@ -0,0 +1,164 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"student-server/auth"
+	"student-server/logging"
+	"student-server/metrics"
+
+	"github.com/gorilla/mux"
+)
+
+// Limiter enforces the limits of a Config on HTTP requests
+type Limiter struct {
+	store    Store
+	settings atomic.Pointer[settings]
+}
+
+type settings struct {
+	Config
+	proxies []netip.Prefix
+}
+
+// New returns a limiter enforcing c with buckets kept in store
+func New(c Config, store Store) (*Limiter, error) {
+	l := &Limiter{store: store}
+	if err := l.SetConfig(c); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// SetConfig replaces the limits. It is safe to call while requests are
+// being served; clients keep the tokens they have left.
+func (l *Limiter) SetConfig(c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	proxies, _ := parseProxies(c.TrustedProxies)
+	l.settings.Store(&settings{Config: c, proxies: proxies})
+	return nil
+}
+
+// Middleware limits the requests of each client to the routes of group.
+// Requests over the limit get 429 with a Retry-After header; every limited
+// response carries RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset.
+// To count by principal it must run after authentication.
+func (l *Limiter) Middleware(group string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s := l.settings.Load()
+			limit := s.limit(group)
+			if !s.Enabled || limit.Unlimited() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			result, err := l.store.Take(r.Context(), group+"|"+s.clientKey(r, limit.Key), limit)
+			if err != nil {
+				// An unreachable shared store must not take the API down
+				logging.FromContext(r.Context()).Warn("rate limit store failed, allowing request", "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			h.Set("RateLimit-Reset", ceilSeconds(result.Reset))
+			if !result.Allowed {
+				metrics.RateLimited.WithLabelValues(group).Inc()
+				h.Set("Retry-After", ceilSeconds(result.RetryAfter))
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP returns the address of the client that sent r. Behind a trusted
+// proxy this is the last address in X-Forwarded-For that isn't a trusted
+// proxy itself; the addresses before it could have been made up by the
+// client.
+func (l *Limiter) ClientIP(r *http.Request) string {
+	return l.settings.Load().clientIP(r)
+}
+
+func (s *settings) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !s.trusted(addr) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break // a garbled entry ends the chain that can be trusted
+		}
+		addr = hop
+		if !s.trusted(hop) {
+			break
+		}
+	}
+	return addr.Unmap().String()
+}
+
+func (s *settings) trusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, proxy := range s.proxies {
+		if proxy.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientKey returns what the requests of r are counted by. The API key
+// header is only believed from a trusted proxy, as the gateway that checked
+// the key; anyone else could send a new one with every request.
+func (s *settings) clientKey(r *http.Request, key string) string {
+	if key == KeyAPIKey && s.fromProxy(r) {
+		if apiKey := r.Header.Get(s.APIKeyHeader); apiKey != "" {
+			// Keys are only kept hashed, in case the store is shared
+			sum := sha256.Sum256([]byte(apiKey))
+			return "key:" + hex.EncodeToString(sum[:16])
+		}
+	}
+	if key != KeyIP {
+		if user, ok := auth.UserFromContext(r.Context()); ok {
+			return "user:" + user
+		}
+	}
+	return "ip:" + s.clientIP(r)
+}
+
+// fromProxy reports whether r was sent by a trusted proxy
+func (s *settings) fromProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	return err == nil && s.trusted(addr)
+}
+
+// ceilSeconds formats d as whole seconds, rounded up
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
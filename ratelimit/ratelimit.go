@@ -0,0 +1,154 @@
+// Package ratelimit limits how fast each client may call the API, with a
+// token bucket per client and route group
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Route groups. Each is limited separately; groups without their own
+// limit use GroupDefault.
+const (
+	GroupDefault  = "default"
+	GroupStudents = "students"
+	GroupWebhooks = "webhooks"
+	GroupGraphQL  = "graphql"
+	GroupStreams  = "streams" // opening event streams and WebSockets
+	GroupAuth     = "auth"    // every call to a protected route, before its credentials are checked
+)
+
+var groups = []string{GroupDefault, GroupStudents, GroupWebhooks, GroupGraphQL, GroupStreams, GroupAuth}
+
+// What a limit counts requests by
+const (
+	KeyPrincipal = "principal" // the authenticated user, else the client IP
+	KeyAPIKey    = "api_key"   // the API key header set by a trusted proxy, else as KeyPrincipal
+	KeyIP        = "ip"        // the client IP
+)
+
+// Limit allows Requests per Per on average, in bursts of up to Burst
+type Limit struct {
+	Requests int           `yaml:"requests" toml:"requests"` // 0 turns the limit off
+	Per      time.Duration `yaml:"per" toml:"per"`
+	Burst    int           `yaml:"burst" toml:"burst"` // defaults to Requests
+	Key      string        `yaml:"key" toml:"key"`     // KeyPrincipal (the default), KeyAPIKey or KeyIP
+}
+
+// Unlimited reports whether the limit is turned off
+func (l Limit) Unlimited() bool {
+	return l.Requests == 0
+}
+
+// rate returns the tokens added to a bucket per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// burst returns the size of the bucket
+func (l Limit) burst() int {
+	if l.Burst == 0 {
+		return l.Requests
+	}
+	return l.Burst
+}
+
+// Validate reports a limit that can't work
+func (l Limit) Validate() error {
+	var errs []error
+	if l.Requests < 0 || l.Burst < 0 {
+		errs = append(errs, errors.New("requests and burst must not be negative"))
+	}
+	if l.Requests > 0 && l.Per <= 0 {
+		errs = append(errs, errors.New("per must be positive"))
+	}
+	switch l.Key {
+	case "", KeyPrincipal, KeyAPIKey, KeyIP:
+	default:
+		errs = append(errs, fmt.Errorf("key %q is not principal, api_key or ip", l.Key))
+	}
+	return errors.Join(errs...)
+}
+
+// Config describes the rate limits of every route group
+type Config struct {
+	Enabled        bool             `yaml:"enabled" toml:"enabled"`
+	TrustedProxies []string         `yaml:"trusted_proxies" toml:"trusted_proxies"` // addresses or CIDR ranges whose X-Forwarded-For is believed
+	APIKeyHeader   string           `yaml:"api_key_header" toml:"api_key_header"`
+	Groups         map[string]Limit `yaml:"groups" toml:"groups"` // by route group
+}
+
+// DefaultConfig returns generous limits that only stop runaway clients
+func DefaultConfig() Config {
+	return Config{
+		Enabled:      true,
+		APIKeyHeader: "X-API-Key",
+		Groups: map[string]Limit{
+			GroupDefault: {Requests: 600, Per: time.Minute, Burst: 100, Key: KeyPrincipal},
+			GroupStreams: {Requests: 30, Per: time.Minute, Burst: 10, Key: KeyPrincipal},
+			GroupAuth:    {Requests: 1200, Per: time.Minute, Burst: 200, Key: KeyIP},
+		},
+	}
+}
+
+// Validate reports settings that can't work
+func (c Config) Validate() error {
+	var errs []error
+	if _, err := parseProxies(c.TrustedProxies); err != nil {
+		errs = append(errs, err)
+	}
+	for name, limit := range c.Groups {
+		if !slices.Contains(groups, name) {
+			errs = append(errs, fmt.Errorf("unknown group %q (want one of %s)", name, strings.Join(groups, ", ")))
+			continue
+		}
+		if err := limit.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("groups.%s: %s", name, strings.ReplaceAll(err.Error(), "\n", "; ")))
+		}
+	}
+	for name, limit := range c.Groups {
+		if limit.Key != KeyAPIKey {
+			continue
+		}
+		if c.APIKeyHeader == "" {
+			errs = append(errs, fmt.Errorf("groups.%s counts by api_key but api_key_header is empty", name))
+		}
+		if len(c.TrustedProxies) == 0 {
+			errs = append(errs, fmt.Errorf("groups.%s counts by api_key but no trusted_proxies check the keys", name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// limit returns the limit of group, falling back to the default group
+func (c Config) limit(group string) Limit {
+	if limit, ok := c.Groups[group]; ok {
+		return limit
+	}
+	return c.Groups[GroupDefault]
+}
+
+// parseProxies parses trusted proxy addresses and CIDR ranges
+func parseProxies(proxies []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		if strings.Contains(proxy, "/") {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("trusted proxy %q is not an address or CIDR range", proxy)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q is not an address or CIDR range", proxy)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Result is the state of a client's bucket after a request
+type Result struct {
+	Allowed    bool
+	Limit      int           // size of the bucket
+	Remaining  int           // requests that may be made straight away
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next request is allowed, when it wasn't
+}
+
+// Store keeps the token buckets. Take spends a token from the bucket of key
+// under limit, if it has one. MemoryStore keeps buckets in the process; a
+// store shared between instances, such as one backed by Redis, makes
+// several servers enforce one limit together.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// sweepInterval is how often a MemoryStore forgets buckets that have filled
+// up again, which are no different from new ones
+const sweepInterval = time.Minute
+
+// MemoryStore keeps token buckets in memory
+type MemoryStore struct {
+	// Now tells the time, time.Now unless set
+	Now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// The limit of the last request, for sweeping
+	rate, burst float64
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}, lastSweep: time.Now()}
+}
+
+// Take spends a token from the bucket of key. It never fails.
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now()
+	if s.Now != nil {
+		now = s.Now()
+	}
+	rate, burst := limit.rate(), float64(limit.burst())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) > sweepInterval {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, updated: now}
+		s.buckets[key] = b
+	}
+	// A reload may have shrunk the bucket
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated, b.rate, b.burst = now, rate, burst
+
+	result := Result{Limit: limit.burst()}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = seconds((burst - b.tokens) / rate)
+	return result, nil
+}
+
+// sweep drops buckets that are full again
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*b.rate >= b.burst {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,563 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        (unknown)
+// source: studentpb/student.proto
+
+package studentpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Student struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Age           int32                  `protobuf:"varint,3,opt,name=age,proto3" json:"age,omitempty"`
+	Grade         string                 `protobuf:"bytes,4,opt,name=grade,proto3" json:"grade,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt     *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Student) Reset() {
+	*x = Student{}
+	mi := &file_studentpb_student_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Student) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Student) ProtoMessage() {}
+
+func (x *Student) ProtoReflect() protoreflect.Message {
+	mi := &file_studentpb_student_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Student.ProtoReflect.Descriptor instead.
+func (*Student) Descriptor() ([]byte, []int) {
+	return file_studentpb_student_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Student) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Student) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Student) GetAge() int32 {
+	if x != nil {
+		return x.Age
+	}
+	return 0
+}
+
+func (x *Student) GetGrade() string {
+	if x != nil {
+		return x.Grade
+	}
+	return ""
+}
+
+func (x *Student) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Student) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+type ListStudentsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Case-insensitive substring of the name
+	Name   string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Grade  string `protobuf:"bytes,2,opt,name=grade,proto3" json:"grade,omitempty"`
+	MinAge int32  `protobuf:"varint,3,opt,name=min_age,json=minAge,proto3" json:"min_age,omitempty"`
+	MaxAge int32  `protobuf:"varint,4,opt,name=max_age,json=maxAge,proto3" json:"max_age,omitempty"`
+	// One of id, name, age, grade, created_at, updated_at (default id)
+	SortBy        string `protobuf:"bytes,5,opt,name=sort_by,json=sortBy,proto3" json:"sort_by,omitempty"`
+	Descending    bool   `protobuf:"varint,6,opt,name=descending,proto3" json:"descending,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListStudentsRequest) Reset() {
+	*x = ListStudentsRequest{}
+	mi := &file_studentpb_student_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListStudentsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListStudentsRequest) ProtoMessage() {}
+
+func (x *ListStudentsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_studentpb_student_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListStudentsRequest.ProtoReflect.Descriptor instead.
+func (*ListStudentsRequest) Descriptor() ([]byte, []int) {
+	return file_studentpb_student_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ListStudentsRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ListStudentsRequest) GetGrade() string {
+	if x != nil {
+		return x.Grade
+	}
+	return ""
+}
+
+func (x *ListStudentsRequest) GetMinAge() int32 {
+	if x != nil {
+		return x.MinAge
+	}
+	return 0
+}
+
+func (x *ListStudentsRequest) GetMaxAge() int32 {
+	if x != nil {
+		return x.MaxAge
+	}
+	return 0
+}
+
+func (x *ListStudentsRequest) GetSortBy() string {
+	if x != nil {
+		return x.SortBy
+	}
+	return ""
+}
+
+func (x *ListStudentsRequest) GetDescending() bool {
+	if x != nil {
+		return x.Descending
+	}
+	return false
+}
+
+type GetStudentRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStudentRequest) Reset() {
+	*x = GetStudentRequest{}
+	mi := &file_studentpb_student_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStudentRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStudentRequest) ProtoMessage() {}
+
+func (x *GetStudentRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_studentpb_student_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStudentRequest.ProtoReflect.Descriptor instead.
+func (*GetStudentRequest) Descriptor() ([]byte, []int) {
+	return file_studentpb_student_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetStudentRequest) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type CreateStudentRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Age           int32                  `protobuf:"varint,2,opt,name=age,proto3" json:"age,omitempty"`
+	Grade         string                 `protobuf:"bytes,3,opt,name=grade,proto3" json:"grade,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateStudentRequest) Reset() {
+	*x = CreateStudentRequest{}
+	mi := &file_studentpb_student_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateStudentRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateStudentRequest) ProtoMessage() {}
+
+func (x *CreateStudentRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_studentpb_student_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateStudentRequest.ProtoReflect.Descriptor instead.
+func (*CreateStudentRequest) Descriptor() ([]byte, []int) {
+	return file_studentpb_student_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *CreateStudentRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *CreateStudentRequest) GetAge() int32 {
+	if x != nil {
+		return x.Age
+	}
+	return 0
+}
+
+func (x *CreateStudentRequest) GetGrade() string {
+	if x != nil {
+		return x.Grade
+	}
+	return ""
+}
+
+// UpdateStudentRequest changes only the fields that are set
+type UpdateStudentRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name          *string                `protobuf:"bytes,2,opt,name=name,proto3,oneof" json:"name,omitempty"`
+	Age           *int32                 `protobuf:"varint,3,opt,name=age,proto3,oneof" json:"age,omitempty"`
+	Grade         *string                `protobuf:"bytes,4,opt,name=grade,proto3,oneof" json:"grade,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateStudentRequest) Reset() {
+	*x = UpdateStudentRequest{}
+	mi := &file_studentpb_student_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateStudentRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateStudentRequest) ProtoMessage() {}
+
+func (x *UpdateStudentRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_studentpb_student_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateStudentRequest.ProtoReflect.Descriptor instead.
+func (*UpdateStudentRequest) Descriptor() ([]byte, []int) {
+	return file_studentpb_student_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *UpdateStudentRequest) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *UpdateStudentRequest) GetName() string {
+	if x != nil && x.Name != nil {
+		return *x.Name
+	}
+	return ""
+}
+
+func (x *UpdateStudentRequest) GetAge() int32 {
+	if x != nil && x.Age != nil {
+		return *x.Age
+	}
+	return 0
+}
+
+func (x *UpdateStudentRequest) GetGrade() string {
+	if x != nil && x.Grade != nil {
+		return *x.Grade
+	}
+	return ""
+}
+
+type DeleteStudentRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteStudentRequest) Reset() {
+	*x = DeleteStudentRequest{}
+	mi := &file_studentpb_student_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteStudentRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteStudentRequest) ProtoMessage() {}
+
+func (x *DeleteStudentRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_studentpb_student_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteStudentRequest.ProtoReflect.Descriptor instead.
+func (*DeleteStudentRequest) Descriptor() ([]byte, []int) {
+	return file_studentpb_student_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *DeleteStudentRequest) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type DeleteStudentResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteStudentResponse) Reset() {
+	*x = DeleteStudentResponse{}
+	mi := &file_studentpb_student_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteStudentResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteStudentResponse) ProtoMessage() {}
+
+func (x *DeleteStudentResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_studentpb_student_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteStudentResponse.ProtoReflect.Descriptor instead.
+func (*DeleteStudentResponse) Descriptor() ([]byte, []int) {
+	return file_studentpb_student_proto_rawDescGZIP(), []int{6}
+}
+
+var File_studentpb_student_proto protoreflect.FileDescriptor
+
+const file_studentpb_student_proto_rawDesc = "" +
+	"\n" +
+	"\x17studentpb/student.proto\x12\n" +
+	"student.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xcb\x01\n" +
+	"\aStudent\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x10\n" +
+	"\x03age\x18\x03 \x01(\x05R\x03age\x12\x14\n" +
+	"\x05grade\x18\x04 \x01(\tR\x05grade\x129\n" +
+	"\n" +
+	"created_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"updated_at\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\"\xaa\x01\n" +
+	"\x13ListStudentsRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05grade\x18\x02 \x01(\tR\x05grade\x12\x17\n" +
+	"\amin_age\x18\x03 \x01(\x05R\x06minAge\x12\x17\n" +
+	"\amax_age\x18\x04 \x01(\x05R\x06maxAge\x12\x17\n" +
+	"\asort_by\x18\x05 \x01(\tR\x06sortBy\x12\x1e\n" +
+	"\n" +
+	"descending\x18\x06 \x01(\bR\n" +
+	"descending\"#\n" +
+	"\x11GetStudentRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\"R\n" +
+	"\x14CreateStudentRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x10\n" +
+	"\x03age\x18\x02 \x01(\x05R\x03age\x12\x14\n" +
+	"\x05grade\x18\x03 \x01(\tR\x05grade\"\x8c\x01\n" +
+	"\x14UpdateStudentRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\x12\x17\n" +
+	"\x04name\x18\x02 \x01(\tH\x00R\x04name\x88\x01\x01\x12\x15\n" +
+	"\x03age\x18\x03 \x01(\x05H\x01R\x03age\x88\x01\x01\x12\x19\n" +
+	"\x05grade\x18\x04 \x01(\tH\x02R\x05grade\x88\x01\x01B\a\n" +
+	"\x05_nameB\x06\n" +
+	"\x04_ageB\b\n" +
+	"\x06_grade\"&\n" +
+	"\x14DeleteStudentRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\"\x17\n" +
+	"\x15DeleteStudentResponse2\x80\x03\n" +
+	"\x0eStudentService\x12F\n" +
+	"\fListStudents\x12\x1f.student.v1.ListStudentsRequest\x1a\x13.student.v1.Student0\x01\x12@\n" +
+	"\n" +
+	"GetStudent\x12\x1d.student.v1.GetStudentRequest\x1a\x13.student.v1.Student\x12F\n" +
+	"\rCreateStudent\x12 .student.v1.CreateStudentRequest\x1a\x13.student.v1.Student\x12F\n" +
+	"\rUpdateStudent\x12 .student.v1.UpdateStudentRequest\x1a\x13.student.v1.Student\x12T\n" +
+	"\rDeleteStudent\x12 .student.v1.DeleteStudentRequest\x1a!.student.v1.DeleteStudentResponseB\x1aZ\x18student-server/studentpbb\x06proto3"
+
+var (
+	file_studentpb_student_proto_rawDescOnce sync.Once
+	file_studentpb_student_proto_rawDescData []byte
+)
+
+func file_studentpb_student_proto_rawDescGZIP() []byte {
+	file_studentpb_student_proto_rawDescOnce.Do(func() {
+		file_studentpb_student_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_studentpb_student_proto_rawDesc), len(file_studentpb_student_proto_rawDesc)))
+	})
+	return file_studentpb_student_proto_rawDescData
+}
+
+var file_studentpb_student_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_studentpb_student_proto_goTypes = []any{
+	(*Student)(nil),               // 0: student.v1.Student
+	(*ListStudentsRequest)(nil),   // 1: student.v1.ListStudentsRequest
+	(*GetStudentRequest)(nil),     // 2: student.v1.GetStudentRequest
+	(*CreateStudentRequest)(nil),  // 3: student.v1.CreateStudentRequest
+	(*UpdateStudentRequest)(nil),  // 4: student.v1.UpdateStudentRequest
+	(*DeleteStudentRequest)(nil),  // 5: student.v1.DeleteStudentRequest
+	(*DeleteStudentResponse)(nil), // 6: student.v1.DeleteStudentResponse
+	(*timestamppb.Timestamp)(nil), // 7: google.protobuf.Timestamp
+}
+var file_studentpb_student_proto_depIdxs = []int32{
+	7, // 0: student.v1.Student.created_at:type_name -> google.protobuf.Timestamp
+	7, // 1: student.v1.Student.updated_at:type_name -> google.protobuf.Timestamp
+	1, // 2: student.v1.StudentService.ListStudents:input_type -> student.v1.ListStudentsRequest
+	2, // 3: student.v1.StudentService.GetStudent:input_type -> student.v1.GetStudentRequest
+	3, // 4: student.v1.StudentService.CreateStudent:input_type -> student.v1.CreateStudentRequest
+	4, // 5: student.v1.StudentService.UpdateStudent:input_type -> student.v1.UpdateStudentRequest
+	5, // 6: student.v1.StudentService.DeleteStudent:input_type -> student.v1.DeleteStudentRequest
+	0, // 7: student.v1.StudentService.ListStudents:output_type -> student.v1.Student
+	0, // 8: student.v1.StudentService.GetStudent:output_type -> student.v1.Student
+	0, // 9: student.v1.StudentService.CreateStudent:output_type -> student.v1.Student
+	0, // 10: student.v1.StudentService.UpdateStudent:output_type -> student.v1.Student
+	6, // 11: student.v1.StudentService.DeleteStudent:output_type -> student.v1.DeleteStudentResponse
+	7, // [7:12] is the sub-list for method output_type
+	2, // [2:7] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_studentpb_student_proto_init() }
+func file_studentpb_student_proto_init() {
+	if File_studentpb_student_proto != nil {
+		return
+	}
+	file_studentpb_student_proto_msgTypes[4].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_studentpb_student_proto_rawDesc), len(file_studentpb_student_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_studentpb_student_proto_goTypes,
+		DependencyIndexes: file_studentpb_student_proto_depIdxs,
+		MessageInfos:      file_studentpb_student_proto_msgTypes,
+	}.Build()
+	File_studentpb_student_proto = out.File
+	file_studentpb_student_proto_goTypes = nil
+	file_studentpb_student_proto_depIdxs = nil
+}
@@ -0,0 +1,159 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"student-server/cache"
+	"student-server/config"
+	"student-server/database"
+	"student-server/metrics"
+	"student-server/models"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewLRU(2, time.Hour)
+	c.Set(ctx, "student:1", []byte("Al Mamun"))
+	c.Set(ctx, "student:2", []byte("Efaz"))
+	c.Get(ctx, "student:1")
+	c.Set(ctx, "student:3", []byte("Ratul")) // evicts student:2, used least recently
+
+	if _, ok := c.Get(ctx, "student:2"); ok {
+		t.Error("Expected the least recently used entry to be evicted")
+	}
+	if v, ok := c.Get(ctx, "student:1"); !ok || string(v) != "Al Mamun" {
+		t.Errorf("Expected student:1 to stay, got %q %v", v, ok)
+	}
+	if c.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", c.Len())
+	}
+
+	c.DeletePrefix(ctx, "student:")
+	if c.Len() != 0 {
+		t.Errorf("Expected DeletePrefix to empty the cache, got %d entries", c.Len())
+	}
+
+	now := time.Now()
+	short := cache.NewLRU(10, 10*time.Millisecond)
+	short.Now = func() time.Time { return now }
+	short.Set(ctx, "students:{}", []byte("[]"))
+	now = now.Add(20 * time.Millisecond)
+	if _, ok := short.Get(ctx, "students:{}"); ok {
+		t.Error("Expected the entry to expire")
+	}
+}
+
+func TestLRUClampsSize(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewLRU(-1, time.Hour)
+	c.Set(ctx, "student:1", []byte("Al Mamun"))
+	c.Set(ctx, "student:2", []byte("Efaz"))
+	if _, ok := c.Get(ctx, "student:2"); !ok || c.Len() != 1 {
+		t.Errorf("Expected a negative size to hold one entry, got %d", c.Len())
+	}
+}
+
+// withStudentCache caches student reads for the rest of the test
+func withStudentCache(t *testing.T) {
+	t.Helper()
+	database.SetStudentCache(cache.NewLRU(100, time.Minute))
+	t.Cleanup(func() { database.SetStudentCache(nil) })
+}
+
+func TestCachedStudent(t *testing.T) {
+	db := setupStudents(t, models.Student{Name: "Al Mamun", Age: 20, Grade: "A"})
+	withStudentCache(t)
+	ctx := context.Background()
+	hits := metrics.CacheRequests.WithLabelValues("student", "hit")
+	misses := metrics.CacheRequests.WithLabelValues("student", "miss")
+	hitsBefore, missesBefore := testutil.ToFloat64(hits), testutil.ToFloat64(misses)
+
+	student, err := database.CachedStudent(ctx, db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Changing the returned copy must not change the cached one
+	student.Name = "Changed"
+	cached, err := database.CachedStudent(ctx, db, 1)
+	if err != nil || cached.Name != "Al Mamun" {
+		t.Fatalf("Expected the cached student, got %+v %v", cached, err)
+	}
+	if got := testutil.ToFloat64(misses) - missesBefore; got != 1 {
+		t.Errorf("Expected 1 miss, got %v", got)
+	}
+	if got := testutil.ToFloat64(hits) - hitsBefore; got != 1 {
+		t.Errorf("Expected 1 hit, got %v", got)
+	}
+
+	// Writes through the database package invalidate the entry
+	cached.Grade = "B"
+	if err := database.UpdateStudent(ctx, db, cached); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := database.CachedStudent(ctx, db, 1); s.Grade != "B" {
+		t.Errorf("Expected the update to be seen, got grade %q", s.Grade)
+	}
+	if err := database.DeleteStudent(ctx, db, cached); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.CachedStudent(ctx, db, 1); err == nil {
+		t.Error("Expected a deleted student not to be found")
+	}
+}
+
+func TestCachedStudents(t *testing.T) {
+	db := setupStudents(t, models.Student{Name: "Al Mamun", Age: 20, Grade: "A"})
+	withStudentCache(t)
+	ctx := context.Background()
+	names := func(q database.StudentQuery) string {
+		t.Helper()
+		students, err := database.CachedStudents(ctx, db, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, s := range students {
+			names = append(names, s.Name)
+		}
+		return strings.Join(names, ",")
+	}
+
+	all := database.StudentQuery{}
+	byName := database.StudentQuery{SortBy: "name", Desc: true}
+	names(all)
+	names(byName)
+
+	// A direct write bypasses invalidation, so the cached list is served
+	db.Create(&models.Student{Name: "Hidden", Age: 30, Grade: "C"})
+	if got := names(all); got != "Al Mamun" {
+		t.Errorf("Expected the cached list, got %q", got)
+	}
+
+	// Creating a student drops every cached list, whatever its query
+	if err := database.CreateStudent(ctx, db, &models.Student{Name: "Efaz", Age: 21, Grade: "B"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(all); got != "Al Mamun,Hidden,Efaz" {
+		t.Errorf("Unexpected list %q", got)
+	}
+	if got := names(byName); got != "Hidden,Efaz,Al Mamun" {
+		t.Errorf("Unexpected sorted list %q", got)
+	}
+}
+
+func TestCacheConfigValidate(t *testing.T) {
+	cfg := config.Default()
+	cfg.Cache.MaxEntries = 0
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "cache.max_entries") {
+		t.Errorf("Expected a cache error, got %v", err)
+	}
+	cfg.Cache.Enabled = false
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected a disabled cache to need no settings, got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"student-server/client"
+	"student-server/models"
+)
+
+func TestClientListAndGet(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "admin" || pass != "password123" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/students":
+			json.NewEncoder(w).Encode([]models.Student{{Name: "Al Mamun", Age: 20, Grade: "A"}})
+		case "/students/1":
+			json.NewEncoder(w).Encode(models.Student{Name: "Efaz", Age: 22, Grade: "B"})
+		default:
+			http.Error(w, "Student not found", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := client.New(server.URL, "admin", "password123")
+
+	students, err := c.ListStudents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(students) != 1 || students[0].Name != "Al Mamun" {
+		t.Errorf("Unexpected students: %+v", students)
+	}
+
+	student, err := c.GetStudent("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if student.Name != "Efaz" {
+		t.Errorf("Expected Efaz, got %q", student.Name)
+	}
+
+	_, err = c.GetStudent("99")
+	apiErr, ok := err.(*client.APIError)
+	if !ok || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "Student not found" {
+		t.Errorf("Expected 404 APIError, got %v", err)
+	}
+
+	_, err = client.New(server.URL, "wrong", "creds").ListStudents()
+	if apiErr, ok := err.(*client.APIError); !ok || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 APIError, got %v", err)
+	}
+}
+
+func TestClientUpdateSendsOnlyGivenFields(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/students/3" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte("Student updated successfully\n"))
+	}))
+	defer server.Close()
+
+	msg, err := client.New(server.URL, "", "").UpdateStudent("3", map[string]interface{}{"grade": "A+"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg != "Student updated successfully" {
+		t.Errorf("Unexpected message %q", msg)
+	}
+	if len(got) != 1 || got["grade"] != "A+" {
+		t.Errorf("Expected only grade to be sent, got %v", got)
+	}
+}
+
+func TestClientEscapesIDs(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		http.Error(w, "Student not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	c := client.New(server.URL, "", "")
+	c.GetStudent("../webhooks")
+	c.DeleteStudent("1?force=true")
+	want := []string{"/students/..%2Fwebhooks", "/students/1%3Fforce=true"}
+	if strings.Join(paths, " ") != strings.Join(want, " ") {
+		t.Errorf("Expected ids to stay in their path segment, got %v", paths)
+	}
+}
+
+func TestClientOutputFormats(t *testing.T) {
+	students := []models.Student{{Name: "Al Mamun", Age: 20, Grade: "A"}}
+	students[0].ID = 7
+
+	var buf bytes.Buffer
+	if err := client.PrintStudents(&buf, client.FormatTable, students); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "ID") || !strings.HasPrefix(lines[1], "7") {
+		t.Errorf("Unexpected table output:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := client.PrintStudents(&buf, client.FormatJSON, students); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"name": "Al Mamun"`) {
+		t.Errorf("Unexpected JSON output:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := client.PrintStudent(&buf, client.FormatYAML, students[0]); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "id: 7") || !strings.Contains(buf.String(), "grade: A") {
+		t.Errorf("Unexpected YAML output:\n%s", buf.String())
+	}
+
+	if err := client.PrintStudents(&buf, "xml", students); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.yaml")
+	content := `default: local
+profiles:
+  local:
+    url: http://localhost:8080
+    username: admin
+    password: password123
+  prod:
+    url: https://students.example.com
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := client.LoadProfile(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.URL != "http://localhost:8080" || p.Username != "admin" {
+		t.Errorf("Expected default profile, got %+v", p)
+	}
+
+	p, err = client.LoadProfile(path, "prod")
+	if err != nil || p.URL != "https://students.example.com" {
+		t.Errorf("Expected prod profile, got %+v (%v)", p, err)
+	}
+
+	if _, err := client.LoadProfile(path, "missing"); err == nil {
+		t.Error("Expected error for unknown profile")
+	}
+
+	if _, err := client.LoadProfile(filepath.Join(t.TempDir(), "none.yaml"), ""); err != nil {
+		t.Errorf("Missing file without a profile name should not fail: %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+package tests
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"student-server/middleware"
+	"student-server/models"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// decompress decodes a response body sent with encoding
+func decompress(t *testing.T, encoding string, body io.Reader) string {
+	t.Helper()
+	var r io.Reader
+	switch encoding {
+	case "gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	case "br":
+		r = brotli.NewReader(body)
+	case "zstd":
+		zr, err := zstd.NewReader(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		r = body
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCompressNegotiation(t *testing.T) {
+	roster := `[` + strings.Repeat(`{"name":"Al Mamun","age":20,"grade":"A"},`, 100) + `{}]`
+	handler := middleware.Compress(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, roster)
+	}))
+
+	tests := []struct {
+		accept, want string
+	}{
+		{"gzip, deflate, br, zstd", "zstd"},
+		{"gzip, br", "br"},
+		{"gzip", "gzip"},
+		{"zstd;q=0, br;q=0.5, gzip", "gzip"},
+		{"*", "zstd"},
+		{"br;q=0, *;q=0.1", "zstd"},
+		{"identity", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/students", nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept-Encoding", tt.accept)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if got := rr.Header().Get("Content-Encoding"); got != tt.want {
+			t.Errorf("%q: got encoding %q, want %q", tt.accept, got, tt.want)
+			continue
+		}
+		if tt.want != "" && rr.Body.Len() >= len(roster) {
+			t.Errorf("%q: body wasn't compressed (%d bytes)", tt.accept, rr.Body.Len())
+		}
+		if body := decompress(t, tt.want, rr.Body); body != roster {
+			t.Errorf("%q: body doesn't round trip", tt.accept)
+		}
+		if rr.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%q: expected Vary: Accept-Encoding, got %q", tt.accept, rr.Header().Get("Vary"))
+		}
+	}
+}
+
+func TestCompressSkips(t *testing.T) {
+	big := strings.Repeat("x", 4096)
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"small", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"name":"Efaz"}`)
+		}},
+		{"binary", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			io.WriteString(w, big)
+		}},
+		{"already encoded", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Content-Encoding", "gzip")
+			io.WriteString(w, big)
+		}},
+		{"event stream", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(http.StatusOK)
+			for i := 0; i < 3; i++ {
+				fmt.Fprintf(w, "data: %s\n\n", big)
+				w.(http.Flusher).Flush()
+			}
+		}},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rr := httptest.NewRecorder()
+		middleware.Compress(1024)(tt.handler).ServeHTTP(rr, req)
+		if enc := rr.Header().Get("Content-Encoding"); enc != "" && tt.name != "already encoded" {
+			t.Errorf("%s: expected no compression, got %q", tt.name, enc)
+		}
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: got status %d", tt.name, rr.Code)
+		}
+	}
+}
+
+func TestCompressKeepsStatus(t *testing.T) {
+	handler := middleware.Compress(16)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, strings.Repeat("Student not found ", 10), http.StatusNotFound)
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound || rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected a compressed 404, got %d %q", rr.Code, rr.Header().Get("Content-Encoding"))
+	}
+	if body := decompress(t, "gzip", rr.Body); !strings.HasPrefix(body, "Student not found") {
+		t.Errorf("Unexpected body %q", body)
+	}
+}
+
+func TestStudentLastModified(t *testing.T) {
+	db := setupStudents(t, models.Student{Name: "Al Mamun", Age: 20, Grade: "A"})
+	router := studentRouter()
+	get := func(since string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/students/1", nil)
+		if since != "" {
+			req.Header.Set("If-Modified-Since", since)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("")
+	lastModified := rr.Header().Get("Last-Modified")
+	if rr.Code != http.StatusOK || lastModified == "" || rr.Header().Get("Cache-Control") != "private, no-cache" {
+		t.Fatalf("Unexpected response %d %v", rr.Code, rr.Header())
+	}
+
+	if rr := get(lastModified); rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+		t.Errorf("Expected 304 for an unchanged student, got %d", rr.Code)
+	}
+	if rr := get("not a date"); rr.Code != http.StatusOK {
+		t.Errorf("Expected an invalid date to be ignored, got %d", rr.Code)
+	}
+
+	// A later update makes the client's copy stale
+	modified, _ := http.ParseTime(lastModified)
+	db.Model(&models.Student{}).Where("id = 1").Update("updated_at", modified.Add(2*time.Second))
+	if rr := get(lastModified); rr.Code != http.StatusOK {
+		t.Errorf("Expected 200 after an update, got %d", rr.Code)
+	}
+}
+
+func TestStudentListETag(t *testing.T) {
+	setupStudents(t,
+		models.Student{Name: "Al Mamun", Age: 20, Grade: "A"},
+		models.Student{Name: "Efaz", Age: 21, Grade: "B"},
+	)
+	router := studentRouter()
+	get := func(etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/students", nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("")
+	etag := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || etag == "" || rr.Header().Get("Cache-Control") != "private, no-cache" {
+		t.Fatalf("Unexpected response %d %v", rr.Code, rr.Header())
+	}
+	if rr := get(`"other", ` + etag); rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+		t.Errorf("Expected 304 for an unchanged list, got %d", rr.Code)
+	}
+
+	// Deleting a student that wasn't the latest change still makes the
+	// client's copy stale
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("DELETE", "/students/1", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Delete failed with %d", rr.Code)
+	}
+	if rr := get(etag); rr.Code != http.StatusOK {
+		t.Errorf("Expected 200 after a delete, got %d", rr.Code)
+	}
+}
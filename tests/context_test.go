@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"student-server/handlers"
+	"student-server/models"
+)
+
+func TestCancelledRequestReturns499(t *testing.T) {
+	setupStudents(t, models.Student{Name: "Al Mamun", Age: 20, Grade: "A"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest("GET", "/students", nil).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	studentRouter().ServeHTTP(rr, req)
+
+	if rr.Code != handlers.StatusClientClosedRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, handlers.StatusClientClosedRequest)
+	}
+}
+
+func TestExpiredDeadlineReturns504(t *testing.T) {
+	setupStudents(t, models.Student{Name: "Al Mamun", Age: 20, Grade: "A"})
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	req := httptest.NewRequest("GET", "/students/1", nil).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	studentRouter().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusGatewayTimeout)
+	}
+}
+
+func TestWithQueryTimeoutSetsDeadline(t *testing.T) {
+	var remaining time.Duration
+	handler := handlers.WithQueryTimeout(time.Minute, func(w http.ResponseWriter, r *http.Request) {
+		deadline, ok := r.Context().Deadline()
+		if !ok {
+			t.Fatal("expected the request context to have a deadline")
+		}
+		remaining = time.Until(deadline)
+	})
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/students", nil))
+
+	if remaining <= 0 || remaining > time.Minute {
+		t.Errorf("unexpected time left: %v", remaining)
+	}
+
+	unlimited := handlers.WithQueryTimeout(0, func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); ok {
+			t.Error("a zero timeout should not set a deadline")
+		}
+	})
+	unlimited(httptest.NewRecorder(), httptest.NewRequest("GET", "/students", nil))
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"student-server/auth"
+	"student-server/config"
+	"student-server/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// corsRouter routes /students behind basic auth with CORS in the router
+// chain, as serve does
+func corsRouter(t *testing.T, policy middleware.CORSConfig) http.Handler {
+	t.Helper()
+	if err := middleware.SetCORSPolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { middleware.SetCORSPolicy(middleware.CORSConfig{}) })
+
+	router := mux.NewRouter()
+	router.Use(middleware.CORS)
+	router.MethodNotAllowedHandler = middleware.CORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}))
+	students := router.PathPrefix("/students").Subrouter()
+	students.Use(auth.BasicAuthMiddleware)
+	students.HandleFunc("/{id}", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET", "PUT")
+	return router
+}
+
+func preflight(handler http.Handler, origin, method, headers string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("OPTIONS", "/students/1", nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", method)
+	if headers != "" {
+		req.Header.Set("Access-Control-Request-Headers", headers)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCORSPreflight(t *testing.T) {
+	policy := middleware.DefaultCORSConfig()
+	policy.AllowedOrigins = []string{"https://app.example.com", "https://*.staging.example.com"}
+	policy.AllowCredentials = true
+	router := corsRouter(t, policy)
+
+	// Preflights carry no credentials and are answered before authentication
+	rr := preflight(router, "https://app.example.com", "PUT", "authorization, content-type")
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", rr.Code, rr.Body)
+	}
+	want := map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Methods":     "GET, POST, PUT, DELETE",
+		"Access-Control-Allow-Headers":     "authorization, content-type",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Max-Age":           "600",
+	}
+	for header, value := range want {
+		if got := rr.Header().Get(header); got != value {
+			t.Errorf("%s: got %q, want %q", header, got, value)
+		}
+	}
+
+	if rr := preflight(router, "https://pr-42.staging.example.com", "DELETE", ""); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected a wildcard subdomain to be allowed, got %d", rr.Code)
+	}
+	for _, origin := range []string{"https://evil.example.com", "https://staging.example.com", "http://app.example.com"} {
+		if rr := preflight(router, origin, "PUT", ""); rr.Code != http.StatusForbidden || rr.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%s: expected 403 without CORS headers, got %d %v", origin, rr.Code, rr.Header())
+		}
+	}
+	if rr := preflight(router, "https://app.example.com", "PATCH", ""); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected PATCH to be refused, got %d", rr.Code)
+	}
+	if rr := preflight(router, "https://app.example.com", "GET", "X-Debug"); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected an unlisted header to be refused, got %d", rr.Code)
+	}
+}
+
+func TestCORSRequests(t *testing.T) {
+	policy := middleware.DefaultCORSConfig()
+	policy.AllowedOrigins = []string{"*"}
+	router := corsRouter(t, policy)
+
+	// Failed authentication is still readable by the frontend
+	req := httptest.NewRequest("GET", "/students/1", nil)
+	req.Header.Set("Origin", "https://anywhere.example")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized || rr.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("Expected 401 with CORS headers, got %d %v", rr.Code, rr.Header())
+	}
+	if !strings.Contains(rr.Header().Get("Access-Control-Expose-Headers"), "X-Request-ID") {
+		t.Errorf("Unexpected exposed headers %q", rr.Header().Get("Access-Control-Expose-Headers"))
+	}
+	if rr.Header().Get("Vary") != "Origin" {
+		t.Errorf("Expected Vary: Origin, got %q", rr.Header().Get("Vary"))
+	}
+
+	// Without an allowed origin the middleware stays out of the way
+	middleware.SetCORSPolicy(middleware.DefaultCORSConfig())
+	if rr := preflight(router, "https://anywhere.example", "PUT", ""); rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected CORS to be off, got %d %v", rr.Code, rr.Header())
+	}
+}
+
+func TestCORSConfigValidate(t *testing.T) {
+	cfg := config.Default()
+	cfg.CORS.AllowedOrigins = []string{"*", "app.example.com", "https://app.*.com", "https://app.example.com/"}
+	cfg.CORS.AllowCredentials = true
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	for _, want := range []string{"allow_credentials", `"app.example.com"`, `"https://app.*.com"`, `"https://app.example.com/"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Error doesn't mention %s: %v", want, err)
+		}
+	}
+
+	cfg.CORS.AllowedOrigins = []string{"https://*.example.com", "http://localhost:3000"}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected valid origins, got %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"student-server/events"
+	"student-server/handlers"
+	"student-server/models"
+)
+
+func TestBrokerResume(t *testing.T) {
+	broker := events.NewBroker(3)
+	for i := 0; i < 5; i++ {
+		broker.Publish(events.StudentCreated, models.Student{Name: "Student"})
+	}
+
+	// History holds events 3..5
+	sub, missed, complete := broker.Subscribe(3, 1)
+	defer broker.Unsubscribe(sub)
+	if !complete || len(missed) != 2 || missed[0].ID != 4 || missed[1].ID != 5 {
+		t.Errorf("Expected complete resume with events 4 and 5, got %v %+v", complete, missed)
+	}
+
+	sub2, _, complete := broker.Subscribe(1, 1)
+	defer broker.Unsubscribe(sub2)
+	if complete {
+		t.Error("Expected incomplete resume when event 2 was evicted")
+	}
+
+	sub3, missed, complete := broker.Subscribe(42, 1)
+	defer broker.Unsubscribe(sub3)
+	if complete || len(missed) != 0 {
+		t.Error("Expected incomplete resume for an ID this broker never issued")
+	}
+}
+
+func TestBrokerDropsSlowSubscriber(t *testing.T) {
+	broker := events.NewBroker(10)
+	sub, _, _ := broker.Subscribe(0, 1)
+
+	broker.Publish(events.StudentCreated, models.Student{Name: "Al Mamun"})
+	broker.Publish(events.StudentUpdated, models.Student{Name: "Al Mamun"})
+
+	if e := <-sub.C; e.Type != events.StudentCreated {
+		t.Errorf("Expected first event to be delivered, got %v", e.Type)
+	}
+	if _, ok := <-sub.C; ok {
+		t.Error("Expected the subscription to be closed after its buffer overflowed")
+	}
+
+	// Unsubscribing a dropped subscriber must not panic
+	broker.Unsubscribe(sub)
+}
+
+func TestStudentEventsHandler(t *testing.T) {
+	broker := events.NewBroker(10)
+	handlers.SetEventBroker(broker)
+	broker.Publish(events.StudentCreated, models.Student{Name: "Al Mamun", Age: 20, Grade: "A"})
+
+	server := httptest.NewServer(http.HandlerFunc(handlers.StudentEventsHandler))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("Last-Event-ID", "0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected text/event-stream, got %q", ct)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		broker.Publish(events.StudentDeleted, models.Student{Name: "Efaz"})
+	}()
+
+	// Last-Event-ID 0 means a fresh subscription, so only the new event arrives
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	var got []string
+	timeout := time.After(2 * time.Second)
+	for len(got) < 3 {
+		select {
+		case line := <-lines:
+			if line != "" {
+				got = append(got, line)
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for event, got %q", got)
+		}
+	}
+
+	if got[0] != "id: 2" || got[1] != "event: student.deleted" || !strings.Contains(got[2], `"name":"Efaz"`) {
+		t.Errorf("Unexpected event lines %q", got)
+	}
+}
+
+func TestStudentEventsHandlerInvalidLastEventID(t *testing.T) {
+	handlers.SetEventBroker(events.NewBroker(10))
+
+	req := httptest.NewRequest("GET", "/students/events", nil)
+	req.Header.Set("Last-Event-ID", "abc")
+	rr := httptest.NewRecorder()
+	handlers.StudentEventsHandler(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
@@ -0,0 +1,202 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"student-server/graph"
+	"student-server/models"
+)
+
+func newGraphQLHandler(t *testing.T, limits graph.Limits) http.Handler {
+	t.Helper()
+	// Limits are enforced before any resolver runs, so no database is needed
+	h, err := graph.NewHandler(nil, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func graphQLErrors(t *testing.T, rr *httptest.ResponseRecorder) []string {
+	t.Helper()
+	var resp struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid JSON response %q: %v", rr.Body.String(), err)
+	}
+	var messages []string
+	for _, e := range resp.Errors {
+		messages = append(messages, e.Message)
+	}
+	return messages
+}
+
+func TestGraphQLDepthLimit(t *testing.T) {
+	handler := newGraphQLHandler(t, graph.Limits{MaxDepth: 3})
+
+	body := `{"query": "{ students { edges { node { name } } } }"}`
+	req := httptest.NewRequest("POST", "/graphql", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+	errs := graphQLErrors(t, rr)
+	if len(errs) != 1 || !strings.Contains(errs[0], "depth 4 exceeds the limit of 3") {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+}
+
+func TestGraphQLComplexityLimit(t *testing.T) {
+	handler := newGraphQLHandler(t, graph.Limits{MaxComplexity: 100})
+
+	// 1 (students) + 1 (edges) + 100 * (1 node + 2 fields) exceeds the limit
+	body := `{"query": "query($n: Int) { students(first: $n) { edges { node { name age } } } }", "variables": {"n": 100}}`
+	req := httptest.NewRequest("POST", "/graphql", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	errs := graphQLErrors(t, rr)
+	if len(errs) != 1 || !strings.Contains(errs[0], "complexity") {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+}
+
+func TestGraphQLBatchComplexityLimit(t *testing.T) {
+	handler := newGraphQLHandler(t, graph.Limits{MaxComplexity: 100})
+
+	// Each operation costs 61, within the limit on its own
+	op := `{"query": "{ students(first: 30) { edges { node } } }"}`
+	req := httptest.NewRequest("POST", "/graphql", strings.NewReader("["+op+","+op+"]"))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+	errs := graphQLErrors(t, rr)
+	if len(errs) != 1 || !strings.Contains(errs[0], "batch complexity 122 exceeds the limit of 100") {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+}
+
+func TestGraphQLRejectsMutationOverGet(t *testing.T) {
+	handler := newGraphQLHandler(t, graph.DefaultLimits)
+
+	query := url.QueryEscape(`mutation { deleteStudent(id: 1) }`)
+	req := httptest.NewRequest("GET", "/graphql?query="+query, nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	errs := graphQLErrors(t, rr)
+	if len(errs) != 1 || errs[0] != "mutations must be sent with POST" {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+}
+
+func TestGraphQLValidatesStudents(t *testing.T) {
+	db := setupStudents(t, models.Student{Name: "Al Mamun", Age: 20, Grade: "A"})
+	h, err := graph.NewHandler(db, graph.DefaultLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, query := range []string{
+		`mutation { createStudent(input: {name: "", age: 20, grade: "A"}) { id } }`,
+		`mutation { updateStudent(id: 1, input: {age: 0}) { id } }`,
+	} {
+		body, _ := json.Marshal(map[string]string{"query": query})
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("POST", "/graphql", strings.NewReader(string(body))))
+		if errs := graphQLErrors(t, rr); len(errs) != 1 || errs[0] != models.ErrInvalidStudent.Error() {
+			t.Errorf("%s: unexpected errors %v", query, errs)
+		}
+	}
+	if students := allStudents(t, db); len(students) != 1 || students[0].Age != 20 {
+		t.Errorf("Invalid writes were stored: %+v", students)
+	}
+}
+
+func TestGraphQLInvalidBatch(t *testing.T) {
+	handler := newGraphQLHandler(t, graph.DefaultLimits)
+
+	req := httptest.NewRequest("POST", "/graphql", strings.NewReader(`[]`))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestGraphQLPagesByCursor(t *testing.T) {
+	db := setupStudents(t,
+		models.Student{Name: "Al Mamun", Age: 20, Grade: "A"},
+		models.Student{Name: "Efaz", Age: 21, Grade: "B"},
+		models.Student{Name: "Nadia", Age: 22, Grade: "A"},
+		models.Student{Name: "Ratul", Age: 23, Grade: "C"},
+	)
+	h, err := graph.NewHandler(db, graph.DefaultLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := func(args string) (names []string, endCursor string) {
+		t.Helper()
+		body, _ := json.Marshal(map[string]string{"query": "{ students(" + args + ") { edges { node { name } } pageInfo { endCursor } } }"})
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("POST", "/graphql", strings.NewReader(string(body))))
+		var resp struct {
+			Data struct {
+				Students struct {
+					Edges []struct {
+						Node struct{ Name string }
+					}
+					PageInfo struct{ EndCursor string }
+				}
+			}
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Invalid response %q", rr.Body.String())
+		}
+		for _, e := range resp.Data.Students.Edges {
+			names = append(names, e.Node.Name)
+		}
+		return names, resp.Data.Students.PageInfo.EndCursor
+	}
+
+	byName := `first: 2, sort: {field: NAME}`
+	names, cursor := page(byName)
+	if strings.Join(names, ",") != "Al Mamun,Efaz" {
+		t.Fatalf("Unexpected first page %v", names)
+	}
+	// A student sorted before the cursor must not push Efaz onto the next page
+	babu := models.Student{Name: "Babu", Age: 20, Grade: "B"}
+	if err := db.Create(&babu).Error; err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := page(byName + `, after: "` + cursor + `"`); strings.Join(names, ",") != "Nadia,Ratul" {
+		t.Errorf("Expected the next page to start after Efaz, got %v", names)
+	}
+
+	// Nor may a deleted student make the next page skip one
+	_, cursor = page(`first: 2`)
+	if err := db.Delete(&models.Student{}, 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := page(`first: 2, after: "` + cursor + `"`); strings.Join(names, ",") != "Nadia,Ratul" {
+		t.Errorf("Expected the next page to start after Efaz, got %v", names)
+	}
+
+	if names, _ := page(byName + `, after: "` + cursor + `"`); names != nil {
+		t.Errorf("Expected a cursor of another sort to be refused, got %v", names)
+	}
+}
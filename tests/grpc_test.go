@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"testing"
+
+	"student-server/grpcserver"
+	"student-server/metrics"
+	"student-server/models"
+	pb "student-server/studentpb"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"gorm.io/gorm"
+)
+
+func dialGRPC(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+	return dialGRPCWith(t, nil)
+}
+
+// dialGRPCWith serves StudentService backed by db over an in-memory listener
+func dialGRPCWith(t *testing.T, db *gorm.DB) *grpc.ClientConn {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server, _ := grpcserver.New(db)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestGRPCRequiresCredentials(t *testing.T) {
+	client := pb.NewStudentServiceClient(dialGRPC(t))
+
+	_, err := client.GetStudent(context.Background(), &pb.GetStudentRequest{Id: 1})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated, got %v", err)
+	}
+
+	creds := base64.StdEncoding.EncodeToString([]byte("wronguser:wrongpass"))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Basic "+creds)
+	stream, err := client.ListStudents(ctx, &pb.ListStudentsRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated for stream, got %v", err)
+	}
+}
+
+func TestGRPCValidatesBeforeQuerying(t *testing.T) {
+	client := pb.NewStudentServiceClient(dialGRPC(t))
+
+	creds := base64.StdEncoding.EncodeToString([]byte("admin:password123"))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Basic "+creds)
+
+	_, err := client.CreateStudent(ctx, &pb.CreateStudentRequest{Name: "Efaz"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+
+	_, err = client.GetStudent(ctx, &pb.GetStudentRequest{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for missing ID, got %v", err)
+	}
+}
+
+func TestGRPCValidatesUpdates(t *testing.T) {
+	db := setupStudents(t, models.Student{Name: "Al Mamun", Age: 20, Grade: "A"})
+	client := pb.NewStudentServiceClient(dialGRPCWith(t, db))
+
+	creds := base64.StdEncoding.EncodeToString([]byte("admin:password123"))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Basic "+creds)
+	age := int32(-3)
+	_, err := client.UpdateStudent(ctx, &pb.UpdateStudentRequest{Id: 1, Age: &age})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+	if students := allStudents(t, db); students[0].Age != 20 {
+		t.Errorf("Invalid update was stored: %+v", students[0])
+	}
+}
+
+func TestGRPCListStudentsInBatches(t *testing.T) {
+	// More than two batches, with many ties on the sort key
+	var students []models.Student
+	for i := 0; i < 250; i++ {
+		students = append(students, models.Student{Name: []string{"Al Mamun", "Efaz", "Ratul"}[i%3], Age: 20, Grade: "A"})
+	}
+	client := pb.NewStudentServiceClient(dialGRPCWith(t, setupStudents(t, students...)))
+
+	creds := base64.StdEncoding.EncodeToString([]byte("admin:password123"))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Basic "+creds)
+	stream, err := client.ListStudents(ctx, &pb.ListStudentsRequest{SortBy: "name", Descending: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[uint64]bool{}
+	var last *pb.Student
+	for {
+		student, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[student.Id] {
+			t.Fatalf("Student %d sent twice", student.Id)
+		}
+		seen[student.Id] = true
+		if last != nil && (student.Name > last.Name || student.Name == last.Name && student.Id < last.Id) {
+			t.Fatalf("Student %d (%s) sent after %d (%s)", student.Id, student.Name, last.Id, last.Name)
+		}
+		last = student
+	}
+	if len(seen) != len(students) {
+		t.Errorf("Expected %d students, got %d", len(students), len(seen))
+	}
+}
+
+func TestGRPCCallsAreObserved(t *testing.T) {
+	client := pb.NewStudentServiceClient(dialGRPC(t))
+	calls := metrics.RPCsTotal.WithLabelValues("/student.v1.StudentService/GetStudent", "Unauthenticated")
+	before := testutil.ToFloat64(calls)
+
+	var header metadata.MD
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-request-id", "grpc-test-1")
+	client.GetStudent(ctx, &pb.GetStudentRequest{Id: 1}, grpc.Header(&header))
+
+	if got := header.Get("x-request-id"); len(got) != 1 || got[0] != "grpc-test-1" {
+		t.Errorf("Expected the request ID to be echoed, got %v", got)
+	}
+	// Failed authentication is counted too
+	if got := testutil.ToFloat64(calls) - before; got != 1 {
+		t.Errorf("Expected 1 call to be counted, got %v", got)
+	}
+}
+
+func TestGRPCHealthIsPublic(t *testing.T) {
+	client := healthpb.NewHealthClient(dialGRPC(t))
+
+	resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{
+		Service: pb.StudentService_ServiceDesc.ServiceName,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("Expected SERVING, got %v", resp.Status)
+	}
+}
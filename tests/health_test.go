@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"student-server/handlers"
+)
+
+// probe calls handler and decodes its health report
+func probe(t *testing.T, handler http.HandlerFunc) (int, handlers.HealthStatus) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/", nil))
+
+	var health handlers.HealthStatus
+	if err := json.NewDecoder(rr.Body).Decode(&health); err != nil {
+		t.Fatalf("invalid health report: %v", err)
+	}
+	return rr.Code, health
+}
+
+func TestHealthz(t *testing.T) {
+	handlers.SetDB(nil)
+	if code, health := probe(t, handlers.HealthzHandler); code != http.StatusOK || health.Status != "ok" {
+		t.Errorf("got %d %+v, want 200 ok even without a database", code, health)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	setupStudents(t)
+
+	code, health := probe(t, handlers.ReadyzHandler)
+	if code != http.StatusOK || health.Status != "ok" {
+		t.Fatalf("got %d %+v, want 200 ok", code, health)
+	}
+	for _, name := range []string{"database", "migrations", "shutdown"} {
+		if health.Components[name].Status != "ok" {
+			t.Errorf("component %s: %+v", name, health.Components[name])
+		}
+	}
+}
+
+func TestReadyzFailsWithPendingMigrations(t *testing.T) {
+	handlers.SetDB(openTestDB(t))
+
+	code, health := probe(t, handlers.ReadyzHandler)
+	if code != http.StatusServiceUnavailable || health.Components["migrations"].Status != "unavailable" {
+		t.Errorf("got %d %+v, want the migrations check to fail", code, health)
+	}
+	if health.Components["database"].Status != "ok" {
+		t.Errorf("database should still be reachable: %+v", health.Components["database"])
+	}
+}
+
+func TestReadyzFailsWhileShuttingDown(t *testing.T) {
+	setupStudents(t)
+	handlers.SetShuttingDown(true)
+	t.Cleanup(func() { handlers.SetShuttingDown(false) })
+
+	code, health := probe(t, handlers.ReadyzHandler)
+	if code != http.StatusServiceUnavailable || health.Components["shutdown"].Status != "unavailable" {
+		t.Errorf("got %d %+v, want the shutdown check to fail", code, health)
+	}
+}
@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"student-server/auth"
+	"student-server/database"
+	"student-server/handlers"
+	"student-server/logging"
+	"student-server/middleware"
+	"student-server/models"
+
+	"github.com/gorilla/mux"
+)
+
+// captureLogs sends the default logger's output to a buffer as JSON
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.Config{Format: logging.FormatJSON, Level: "debug"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+// logRecords decodes the JSON records in buf with the given message
+func logRecords(t *testing.T, buf *bytes.Buffer, msg string) []map[string]interface{} {
+	t.Helper()
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		if record["msg"] == msg {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+func TestRequestIDHeader(t *testing.T) {
+	handler := middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if logging.RequestID(r.Context()) != w.Header().Get(middleware.RequestIDHeader) {
+			t.Error("the context and the response disagree on the request ID")
+		}
+	}))
+
+	tests := []struct {
+		name, sent string
+		kept       bool
+	}{
+		{"generated", "", false},
+		{"propagated", "checkout-42", true},
+		{"control characters", "evil\nINFO forged", false},
+		{"too long", strings.Repeat("x", 200), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.sent != "" {
+				req.Header.Set(middleware.RequestIDHeader, tt.sent)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			got := rr.Header().Get(middleware.RequestIDHeader)
+			if got == "" {
+				t.Fatal("no request ID in the response")
+			}
+			if (got == tt.sent) != tt.kept {
+				t.Errorf("got request ID %q for %q", got, tt.sent)
+			}
+		})
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	buf := captureLogs(t)
+	setupStudents(t, models.Student{Name: "Al Mamun", Age: 20, Grade: "A"})
+
+	router := mux.NewRouter()
+	router.Use(middleware.RequestID, middleware.AccessLog)
+	students := router.PathPrefix("/students").Subrouter()
+	students.Use(auth.BasicAuthMiddleware)
+	students.HandleFunc("/{id}", handlers.GetStudentByIDHandler).Methods("GET")
+
+	req := httptest.NewRequest("GET", "/students/1", nil)
+	req.SetBasicAuth("admin", "password123")
+	req.Header.Set(middleware.RequestIDHeader, "req-1")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	records := logRecords(t, buf, "request")
+	if len(records) != 1 {
+		t.Fatalf("expected 1 access log record, got %d: %s", len(records), buf)
+	}
+	record := records[0]
+	want := map[string]interface{}{
+		"level":      "INFO",
+		"method":     "GET",
+		"route":      "/students/{id}",
+		"path":       "/students/1",
+		"status":     float64(http.StatusOK),
+		"bytes":      float64(rr.Body.Len()),
+		"user":       "admin",
+		"request_id": "req-1",
+	}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("%s: got %v want %v", key, record[key], value)
+		}
+	}
+	if _, ok := record["duration_ms"]; !ok {
+		t.Error("access log has no duration")
+	}
+}
+
+func TestDatabaseLogsCarryRequestID(t *testing.T) {
+	buf := captureLogs(t)
+	db := openTestDB(t)
+	db.Logger = logging.NewGormLogger(0)
+
+	// The table doesn't exist without migrations, so the query fails
+	ctx := logging.WithRequestID(context.Background(), "req-2")
+	if _, err := database.CountStudents(ctx, db, database.StudentFilter{}); err == nil {
+		t.Fatal("expected the query to fail")
+	}
+
+	records := logRecords(t, buf, "query failed")
+	if len(records) != 1 {
+		t.Fatalf("expected 1 failed query record, got %d: %s", len(records), buf)
+	}
+	if records[0]["request_id"] != "req-2" || records[0]["level"] != "ERROR" {
+		t.Errorf("unexpected record %v", records[0])
+	}
+}
+
+func TestLoggingConfig(t *testing.T) {
+	if _, err := logging.New(&bytes.Buffer{}, logging.Config{Format: "xml", Level: "info"}); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+	if _, err := logging.New(&bytes.Buffer{}, logging.Config{Format: "text", Level: "loud"}); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.Config{Format: "text", Level: "warn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("hidden")
+	logger.Warn("shown")
+	if strings.Contains(buf.String(), "hidden") || !strings.Contains(buf.String(), "shown") {
+		t.Errorf("unexpected output at warn level: %q", buf.String())
+	}
+}
+
+func TestSetLogLevel(t *testing.T) {
+	var buf bytes.Buffer
+	if err := logging.Setup(&buf, logging.Config{Format: "text", Level: "warn"}); err != nil {
+		t.Fatal(err)
+	}
+	previous := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	logger := slog.Default().With("component", "test")
+	logger.Info("before")
+	if err := logging.SetLevel("info"); err != nil {
+		t.Fatal(err)
+	}
+	// Loggers derived before the change follow it too
+	logger.Info("after")
+	if strings.Contains(buf.String(), "before") || !strings.Contains(buf.String(), "after") {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+
+	if err := logging.SetLevel("loud"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
@@ -2,17 +2,56 @@ package tests
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"student-server/database"
 	"student-server/handlers"
 	"student-server/models"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
 )
 
-var students []models.Student
+// setupStudents points the handlers at a fresh database holding students
+// and returns it
+func setupStudents(t *testing.T, students ...models.Student) *gorm.DB {
+	t.Helper()
+	db := newTestDB(t)
+	for i := range students {
+		if err := database.CreateStudent(context.Background(), db, &students[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handlers.SetDB(db)
+	return db
+}
+
+// studentRouter routes student requests the same way the server does
+func studentRouter() http.Handler {
+	router := mux.NewRouter()
+	router.HandleFunc("/students", handlers.GetStudentsHandler).Methods("GET")
+	router.HandleFunc("/students", handlers.AddStudentHandler).Methods("POST")
+	router.HandleFunc("/students/{id}", handlers.GetStudentByIDHandler).Methods("GET")
+	router.HandleFunc("/students/{id}", handlers.UpdateStudentHandler).Methods("PUT")
+	router.HandleFunc("/students/{id}", handlers.DeleteStudentHandler).Methods("DELETE")
+	return router
+}
+
+// allStudents returns every student in db
+func allStudents(t *testing.T, db *gorm.DB) []models.Student {
+	t.Helper()
+	students, err := database.ListStudents(context.Background(), db, database.StudentQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return students
+}
 
 func TestHomeHandler(t *testing.T) {
 	req, err := http.NewRequest("GET", "/", nil)
@@ -24,7 +63,7 @@ func TestHomeHandler(t *testing.T) {
 	handler := http.HandlerFunc(handlers.HomeHandler)
 	handler.ServeHTTP(rr, req)
 
-	expected := "Welcome to the Student API!\n"
+	expected := "Welcome to the Student API! Made my Mamun ;)\n"
 	if rr.Body.String() != expected {
 		t.Errorf("Expected %q, got %q", expected, rr.Body.String())
 	}
@@ -35,8 +74,8 @@ func TestHomeHandler(t *testing.T) {
 }
 
 func TestGetStudents(t *testing.T) {
-	// Case 1: When students slice is empty
-	students = []models.Student{} // Initialize the students slice as empty
+	// Case 1: When there are no students
+	setupStudents(t)
 	req, err := http.NewRequest("GET", "/students", nil)
 	if err != nil {
 		t.Fatal(err)
@@ -51,11 +90,11 @@ func TestGetStudents(t *testing.T) {
 		t.Errorf("[Empty Students] Expected %q, got %q", expectedEmpty, rr.Body.String())
 	}
 
-	// Case 2: When students slice has multiple entries
-	students = []models.Student{
-		{Name: "Al Mamun", Age: 20, Grade: "A"},
-		{Name: "Efaz", Age: 22, Grade: "B"},
-	}
+	// Case 2: When there are multiple students
+	db := setupStudents(t,
+		models.Student{Name: "Al Mamun", Age: 20, Grade: "A"},
+		models.Student{Name: "Efaz", Age: 22, Grade: "B"},
+	)
 
 	req, err = http.NewRequest("GET", "/students", nil)
 	if err != nil {
@@ -65,8 +104,8 @@ func TestGetStudents(t *testing.T) {
 	rr = httptest.NewRecorder()
 	handler.ServeHTTP(rr, req)
 
-	// Marshal the students slice into JSON for comparison
-	expectedJSON, err := json.Marshal(students)
+	// Marshal the stored students into JSON for comparison
+	expectedJSON, err := json.Marshal(allStudents(t, db))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -79,7 +118,7 @@ func TestGetStudents(t *testing.T) {
 
 func TestPostStudent(t *testing.T) {
 	t.Run("Valid Student", func(t *testing.T) {
-		students = []models.Student{} // Reset student slice
+		db := setupStudents(t)
 		newStudent := models.Student{Name: "Al Mamun", Age: 20, Grade: "A+"}
 
 		studentJSON, err := json.Marshal(newStudent)
@@ -103,12 +142,13 @@ func TestPostStudent(t *testing.T) {
 			t.Errorf("Expected status %d, got %d", http.StatusCreated, rr.Code)
 		}
 
-		expected := "Student added successfully"
+		expected := "Student added successfully\n"
 		if rr.Body.String() != expected {
 			t.Errorf("Expected %q, got %q", expected, rr.Body.String())
 		}
 
 		// Verify that student is added
+		students := allStudents(t, db)
 		if len(students) != 1 || students[0].Name != "Al Mamun" {
 			t.Errorf("Student was not added correctly")
 		}
@@ -138,7 +178,8 @@ func TestPostStudent(t *testing.T) {
 	})
 
 	t.Run("Missing Fields", func(t *testing.T) {
-		newStudent := models.Student{Name: "Efaz"} // Missing ID, Age, Grade
+		db := setupStudents(t)
+		newStudent := models.Student{Name: "Efaz"} // Missing Age, Grade
 
 		studentJSON, err := json.Marshal(newStudent)
 		if err != nil {
@@ -165,15 +206,20 @@ func TestPostStudent(t *testing.T) {
 		if rr.Body.String() != expected {
 			t.Errorf("Expected %q, got %q", expected, rr.Body.String())
 		}
+
+		if len(allStudents(t, db)) != 0 {
+			t.Errorf("Incomplete student was stored")
+		}
 	})
 }
 
 func TestGetStudentByID(t *testing.T) {
 	// Initialize test data
-	students = []models.Student{
-		{Name: "Al Mamun", Age: 20, Grade: "A"},
-		{Name: "Efaz", Age: 22, Grade: "B+"},
-	}
+	db := setupStudents(t,
+		models.Student{Name: "Al Mamun", Age: 20, Grade: "A"},
+		models.Student{Name: "Efaz", Age: 22, Grade: "B+"},
+	)
+	router := studentRouter()
 
 	t.Run("Valid Student ID", func(t *testing.T) {
 		req, err := http.NewRequest("GET", "/students/1", nil)
@@ -183,11 +229,14 @@ func TestGetStudentByID(t *testing.T) {
 
 		rr := httptest.NewRecorder()
 
-		// Use the actual GetStudentByIDHandler here
-		handler := http.HandlerFunc(handlers.GetStudentByIDHandler)
-		handler.ServeHTTP(rr, req)
+		// Route to the actual GetStudentByIDHandler here
+		router.ServeHTTP(rr, req)
 
-		expected := `{"ID":"1","Name":"Al Mamun","Age":20,"Grade":"A"}` + "\n"
+		expectedJSON, err := json.Marshal(allStudents(t, db)[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := string(expectedJSON) + "\n"
 		if rr.Body.String() != expected {
 			t.Errorf("Expected %q, got %q", expected, rr.Body.String())
 		}
@@ -200,10 +249,7 @@ func TestGetStudentByID(t *testing.T) {
 		}
 
 		rr := httptest.NewRecorder()
-
-		// Use the actual GetStudentByIDHandler here
-		handler := http.HandlerFunc(handlers.GetStudentByIDHandler)
-		handler.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusNotFound {
 			t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
@@ -216,7 +262,7 @@ func TestGetStudentByID(t *testing.T) {
 	})
 
 	t.Run("Empty Student List", func(t *testing.T) {
-		students = []models.Student{} // Simulate empty database
+		setupStudents(t) // Simulate empty database
 
 		req, err := http.NewRequest("GET", "/students/1", nil)
 		if err != nil {
@@ -224,10 +270,7 @@ func TestGetStudentByID(t *testing.T) {
 		}
 
 		rr := httptest.NewRecorder()
-
-		// Use the actual GetStudentByIDHandler here
-		handler := http.HandlerFunc(handlers.GetStudentByIDHandler)
-		handler.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusNotFound {
 			t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
@@ -246,10 +289,7 @@ func TestGetStudentByID(t *testing.T) {
 		}
 
 		rr := httptest.NewRecorder()
-
-		// Use the actual GetStudentByIDHandler here
-		handler := http.HandlerFunc(handlers.GetStudentByIDHandler)
-		handler.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusBadRequest {
 			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
@@ -264,10 +304,11 @@ func TestGetStudentByID(t *testing.T) {
 
 func TestUpdateStudent(t *testing.T) {
 	// Initialize students with test data
-	students = []models.Student{
-		{Name: "Al Mamun", Age: 20, Grade: "A"},
-		{Name: "Efaz", Age: 22, Grade: "B+"},
-	}
+	db := setupStudents(t,
+		models.Student{Name: "Al Mamun", Age: 20, Grade: "A"},
+		models.Student{Name: "Efaz", Age: 22, Grade: "B+"},
+	)
+	router := studentRouter()
 
 	t.Run("Valid Student Update", func(t *testing.T) {
 		updatedStudent := models.Student{Name: "Efaz", Age: 21, Grade: "B"}
@@ -283,19 +324,19 @@ func TestUpdateStudent(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(handlers.UpdateStudentHandler)
-		handler.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusOK {
 			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
 		}
 
-		expected := "Student updated successfully"
+		expected := "Student updated successfully\n"
 		if rr.Body.String() != expected {
 			t.Errorf("Expected %q, got %q", expected, rr.Body.String())
 		}
 
 		// Verify that the student was actually updated
+		students := allStudents(t, db)
 		if students[0].Name != "Efaz" || students[0].Age != 21 || students[0].Grade != "B" {
 			t.Errorf("Student was not updated correctly")
 		}
@@ -315,8 +356,7 @@ func TestUpdateStudent(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(handlers.UpdateStudentHandler)
-		handler.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusNotFound {
 			t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
@@ -342,8 +382,7 @@ func TestUpdateStudent(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(handlers.UpdateStudentHandler)
-		handler.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusBadRequest {
 			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
@@ -354,14 +393,33 @@ func TestUpdateStudent(t *testing.T) {
 			t.Errorf("Expected %q, got %q", expected, rr.Body.String())
 		}
 	})
+
+	t.Run("Invalid Fields", func(t *testing.T) {
+		req, err := http.NewRequest("PUT", "/students/2", strings.NewReader(`{"name": "", "age": -1}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+		if students := allStudents(t, db); students[1].Name != "Efaz" || students[1].Age != 22 {
+			t.Errorf("Invalid update was stored: %+v", students[1])
+		}
+	})
 }
 
 func TestDeleteStudent(t *testing.T) {
 	// Initialize students with multiple entries
-	students = []models.Student{
-		{Name: "Al Mamun", Age: 20, Grade: "A"},
-		{Name: "Efaz", Age: 22, Grade: "B+"},
-	}
+	db := setupStudents(t,
+		models.Student{Name: "Al Mamun", Age: 20, Grade: "A"},
+		models.Student{Name: "Efaz", Age: 22, Grade: "B+"},
+	)
+	router := studentRouter()
 
 	t.Run("Delete Existing Student", func(t *testing.T) {
 		req, err := http.NewRequest("DELETE", "/students/1", nil)
@@ -370,32 +428,19 @@ func TestDeleteStudent(t *testing.T) {
 		}
 
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			id := r.URL.Path[len("/students/"):]
-			for i, student := range students {
-				if string(student.ID) == id {
-					students = append(students[:i], students[i+1:]...)
-					w.WriteHeader(http.StatusOK)
-					w.Write([]byte("Student deleted successfully"))
-					return
-				}
-			}
-			http.Error(w, "Student not found", http.StatusNotFound)
-		})
-
-		handler.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusOK {
 			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
 		}
 
-		expected := "Student deleted successfully"
+		expected := "Student deleted successfully\n"
 		if rr.Body.String() != expected {
 			t.Errorf("Expected %q, got %q", expected, rr.Body.String())
 		}
 
 		// Verify that the student was actually deleted
-		for _, student := range students {
+		for _, student := range allStudents(t, db) {
 			if student.ID == 1 {
 				t.Errorf("Student was not deleted")
 			}
@@ -409,20 +454,7 @@ func TestDeleteStudent(t *testing.T) {
 		}
 
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			id := r.URL.Path[len("/students/"):]
-			for i, student := range students {
-				if string(student.ID) == id {
-					students = append(students[:i], students[i+1:]...)
-					w.WriteHeader(http.StatusOK)
-					w.Write([]byte("Student deleted successfully"))
-					return
-				}
-			}
-			http.Error(w, "Student not found", http.StatusNotFound)
-		})
-
-		handler.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusNotFound {
 			t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
@@ -435,7 +467,7 @@ func TestDeleteStudent(t *testing.T) {
 	})
 
 	t.Run("Delete from Empty Student List", func(t *testing.T) {
-		students = []models.Student{} // Simulate an empty list
+		setupStudents(t) // Simulate an empty database
 
 		req, err := http.NewRequest("DELETE", "/students/1", nil)
 		if err != nil {
@@ -443,20 +475,7 @@ func TestDeleteStudent(t *testing.T) {
 		}
 
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			id := r.URL.Path[len("/students/"):]
-			for i, student := range students {
-				if string(student.ID) == id {
-					students = append(students[:i], students[i+1:]...)
-					w.WriteHeader(http.StatusOK)
-					w.Write([]byte("Student deleted successfully"))
-					return
-				}
-			}
-			http.Error(w, "Student not found", http.StatusNotFound)
-		})
-
-		handler.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusNotFound {
 			t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
@@ -475,24 +494,7 @@ func TestDeleteStudent(t *testing.T) {
 		}
 
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			id := r.URL.Path[len("/students/"):]
-			if id == "" || id == "abc" {
-				http.Error(w, "Invalid student ID", http.StatusBadRequest)
-				return
-			}
-			for i, student := range students {
-				if string(student.ID) == id {
-					students = append(students[:i], students[i+1:]...)
-					w.WriteHeader(http.StatusOK)
-					w.Write([]byte("Student deleted successfully"))
-					return
-				}
-			}
-			http.Error(w, "Student not found", http.StatusNotFound)
-		})
-
-		handler.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusBadRequest {
 			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
@@ -505,11 +507,11 @@ func TestDeleteStudent(t *testing.T) {
 	})
 
 	t.Run("Ensure Remaining Students Exist", func(t *testing.T) {
-		students = []models.Student{
-			{Name: "Al Mamun", Age: 20, Grade: "A"},
-			{Name: "Efaz", Age: 22, Grade: "B+"},
-			{Name: "Al Mamun", Age: 20, Grade: "A+"},
-		}
+		db := setupStudents(t,
+			models.Student{Name: "Al Mamun", Age: 20, Grade: "A"},
+			models.Student{Name: "Efaz", Age: 22, Grade: "B+"},
+			models.Student{Name: "Al Mamun", Age: 20, Grade: "A+"},
+		)
 
 		req, err := http.NewRequest("DELETE", "/students/2", nil) // Deleting "Efaz"
 		if err != nil {
@@ -517,31 +519,19 @@ func TestDeleteStudent(t *testing.T) {
 		}
 
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			id := r.URL.Path[len("/students/"):]
-			for i, student := range students {
-				if string(student.ID) == id {
-					students = append(students[:i], students[i+1:]...)
-					w.WriteHeader(http.StatusOK)
-					w.Write([]byte("Student deleted successfully"))
-					return
-				}
-			}
-			http.Error(w, "Student not found", http.StatusNotFound)
-		})
-
-		handler.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusOK {
 			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
 		}
 
-		expected := "Student deleted successfully"
+		expected := "Student deleted successfully\n"
 		if rr.Body.String() != expected {
 			t.Errorf("Expected %q, got %q", expected, rr.Body.String())
 		}
 
 		// Verify that only student with ID "2" was deleted, and others remain
+		students := allStudents(t, db)
 		if len(students) != 2 {
 			t.Errorf("Expected 2 students remaining, got %d", len(students))
 		}
@@ -573,6 +563,7 @@ func createAuthRequest(method, url, username, password string, body string) *htt
 
 // Test accessing a protected route **without authentication** (should fail)
 func TestAuthWithoutCredentials(t *testing.T) {
+	setupStudents(t)
 	req := httptest.NewRequest("GET", "/students", nil) // No auth
 	rr := httptest.NewRecorder()
 	// Wrap handler with middleware
@@ -587,6 +578,7 @@ func TestAuthWithoutCredentials(t *testing.T) {
 
 // Test accessing a protected route **with valid credentials** (should succeed)
 func TestAuthWithValidCredentials(t *testing.T) {
+	setupStudents(t)
 	req := createAuthRequest("GET", "/students", "admin", "password123", "")
 	rr := httptest.NewRecorder()
 	// Wrap handler with middleware
@@ -601,6 +593,7 @@ func TestAuthWithValidCredentials(t *testing.T) {
 
 // Test accessing a protected route **with invalid credentials** (should fail)
 func TestAuthWithInvalidCredentials(t *testing.T) {
+	setupStudents(t)
 	req := createAuthRequest("GET", "/students", "wronguser", "wrongpass", "")
 	rr := httptest.NewRecorder()
 	// Wrap handler with middleware
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"student-server/auth"
+	"student-server/metrics"
+	"student-server/models"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsMiddlewareLabelsRouteTemplates(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(metrics.Middleware)
+	router.HandleFunc("/students/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if got := testutil.ToFloat64(metrics.RequestsInFlight); got != 1 {
+			t.Errorf("in-flight requests while handling: got %v want 1", got)
+		}
+		http.Error(w, "Student not found", http.StatusNotFound)
+	}).Methods("GET")
+
+	counter := metrics.RequestsTotal.WithLabelValues("/students/{id}", "GET", "404")
+	before := testutil.ToFloat64(counter)
+	for _, id := range []string{"1", "2", "3"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/students/"+id, nil))
+	}
+
+	if got := testutil.ToFloat64(counter) - before; got != 3 {
+		t.Errorf("requests counted under the route template: got %v want 3", got)
+	}
+	if got := testutil.ToFloat64(metrics.RequestsInFlight); got != 0 {
+		t.Errorf("in-flight requests after handling: got %v want 0", got)
+	}
+}
+
+func TestMetricsAuthFailures(t *testing.T) {
+	handler := auth.BasicAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	missing := metrics.AuthFailures.WithLabelValues("http", "missing")
+	invalid := metrics.AuthFailures.WithLabelValues("http", "invalid")
+	beforeMissing, beforeInvalid := testutil.ToFloat64(missing), testutil.ToFloat64(invalid)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/students", nil))
+	req := httptest.NewRequest("GET", "/students", nil)
+	req.SetBasicAuth("admin", "wrong")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := testutil.ToFloat64(missing) - beforeMissing; got != 1 {
+		t.Errorf("missing credentials: got %v want 1", got)
+	}
+	if got := testutil.ToFloat64(invalid) - beforeInvalid; got != 1 {
+		t.Errorf("invalid credentials: got %v want 1", got)
+	}
+}
+
+func TestMetricsEndpointExportsDatabaseMetrics(t *testing.T) {
+	db := setupStudents(t, models.Student{Name: "Al Mamun", Age: 20, Grade: "A"})
+	if err := metrics.InstrumentDB(db, "primary"); err != nil {
+		t.Fatal(err)
+	}
+	allStudents(t, db)
+
+	rr := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	body, _ := io.ReadAll(rr.Body)
+	for _, want := range []string{
+		`db_query_duration_seconds_count{operation="query",table="students"}`,
+		`go_sql_open_connections{db_name="primary"}`,
+		`http_requests_in_flight`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics output is missing %s", want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"student-server/database"
+)
+
+var testMigrations = fstest.MapFS{
+	"0001_create_courses.up.sql":   {Data: []byte("CREATE TABLE courses (id INTEGER PRIMARY KEY, title TEXT NOT NULL);")},
+	"0001_create_courses.down.sql": {Data: []byte("DROP TABLE courses;")},
+	"0002_add_credits.up.sql": {Data: []byte(`ALTER TABLE courses ADD COLUMN credits INTEGER NOT NULL DEFAULT 3;
+INSERT INTO courses (title) VALUES ('Algebra');`)},
+	"0002_add_credits.down.sql": {Data: []byte("ALTER TABLE courses DROP COLUMN credits;")},
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	db := openTestDB(t)
+	m, err := database.NewMigrator(db, testMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := m.Up()
+	if err != nil || len(applied) != 2 || applied[0].Version != 1 || applied[1].Version != 2 {
+		t.Fatalf("Expected migrations 1 and 2 to be applied, got %+v (%v)", applied, err)
+	}
+	var credits int
+	db.Raw("SELECT credits FROM courses WHERE title = 'Algebra'").Scan(&credits)
+	if credits != 3 {
+		t.Errorf("Expected migrated column with default 3, got %d", credits)
+	}
+
+	// Running again is a no-op
+	if applied, err := m.Up(); err != nil || len(applied) != 0 {
+		t.Errorf("Expected nothing to apply, got %+v (%v)", applied, err)
+	}
+
+	rolledBack, err := m.Down(1)
+	if err != nil || len(rolledBack) != 1 || rolledBack[0].Version != 2 {
+		t.Fatalf("Expected migration 2 to be rolled back, got %+v (%v)", rolledBack, err)
+	}
+	if db.Migrator().HasColumn("courses", "credits") {
+		t.Error("Expected credits column to be dropped")
+	}
+
+	status, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status[0].Applied || status[1].Applied {
+		t.Errorf("Unexpected status %+v", status)
+	}
+}
+
+func TestMigrateStopsAtFailure(t *testing.T) {
+	db := openTestDB(t)
+	fsys := fstest.MapFS{
+		"0001_create_courses.up.sql": testMigrations["0001_create_courses.up.sql"],
+		"0002_broken.up.sql":         {Data: []byte("INSERT INTO courses (title) VALUES ('Physics'); ALTER TABLE nope ADD COLUMN x INTEGER;")},
+	}
+	m, err := database.NewMigrator(db, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := m.Up()
+	if err == nil || !strings.Contains(err.Error(), "0002_broken") {
+		t.Fatalf("Expected migration 2 to fail, got %v", err)
+	}
+	if len(applied) != 1 {
+		t.Errorf("Expected only migration 1 to be applied, got %+v", applied)
+	}
+
+	// The failed migration's changes are rolled back with it
+	var count int64
+	db.Table("courses").Count(&count)
+	if count != 0 {
+		t.Errorf("Expected failed migration to leave no rows, found %d", count)
+	}
+	status, _ := m.Status()
+	if status[1].Applied {
+		t.Error("Failed migration was recorded as applied")
+	}
+
+	if _, err := m.Down(1); err == nil {
+		t.Error("Expected rolling back a migration without a down script to fail")
+	}
+}
+
+func TestLoadMigrationsRejectsBadFiles(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"bad name":  {"create_courses.up.sql": {Data: []byte("SELECT 1;")}},
+		"no up":     {"0001_create_courses.down.sql": {Data: []byte("SELECT 1;")}},
+		"two names": {"0001_a.up.sql": {Data: []byte("SELECT 1;")}, "0001_b.up.sql": {Data: []byte("SELECT 1;")}},
+	}
+	for name, fsys := range tests {
+		if _, err := database.LoadMigrations(fsys); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestEmbeddedMigrationsMatchAcrossDialects(t *testing.T) {
+	var want []database.Migration
+	for _, dialect := range []string{database.DriverPostgres, database.DriverSQLite} {
+		fsys, err := database.Migrations(dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		migrations, err := database.LoadMigrations(fsys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(migrations) == 0 {
+			t.Fatalf("No %s migrations embedded", dialect)
+		}
+		if want == nil {
+			want = migrations
+		}
+		if len(migrations) != len(want) {
+			t.Errorf("%s has %d migrations, expected %d", dialect, len(migrations), len(want))
+			continue
+		}
+
+		for i, m := range migrations {
+			if m.Version != int64(i+1) || m.Name != want[i].Name {
+				t.Errorf("%s: migration %04d_%s, expected %04d_%s", dialect, m.Version, m.Name, i+1, want[i].Name)
+			}
+			if strings.TrimSpace(m.Down) == "" {
+				t.Errorf("%s: migration %04d_%s has no down script", dialect, m.Version, m.Name)
+			}
+		}
+	}
+
+	if _, err := database.Migrations("oracle"); err == nil {
+		t.Error("Expected an unknown dialect to have no migrations")
+	}
+}
+
+func TestEmbeddedMigrationsRoundTrip(t *testing.T) {
+	db := newTestDB(t)
+	m, err := database.NewMigratorFor(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Down(len(m.Migrations)); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"students", "webhook_subscriptions", "outbox"} {
+		if db.Migrator().HasTable(table) {
+			t.Errorf("Table %s survived rolling back every migration", table)
+		}
+	}
+	if applied, err := m.Up(); err != nil || len(applied) != len(m.Migrations) {
+		t.Errorf("Expected every migration to apply again, got %d (%v)", len(applied), err)
+	}
+}
+
+func TestCreateMigration(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "0001_create_courses.up.sql"), []byte("SELECT 1;"), 0o644)
+
+	paths, err := database.CreateMigration(dir, "Add Email To Students")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(dir, "0002_add_email_to_students.up.sql"),
+		filepath.Join(dir, "0002_add_email_to_students.down.sql"),
+	}
+	if len(paths) != 2 || paths[0] != want[0] || paths[1] != want[1] {
+		t.Errorf("Expected %v, got %v", want, paths)
+	}
+
+	if _, err := database.CreateMigration(dir, "drop; table"); err == nil {
+		t.Error("Expected invalid name to be rejected")
+	}
+}
+
+func TestCreateMigrationForEveryDialect(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "postgres"), 0o755)
+	os.Mkdir(filepath.Join(dir, "sqlite"), 0o755)
+	os.WriteFile(filepath.Join(dir, "postgres", "0003_create_outbox.up.sql"), []byte("SELECT 1;"), 0o644)
+
+	paths, err := database.CreateMigration(dir, "add_email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(dir, "postgres", "0004_add_email.up.sql"),
+		filepath.Join(dir, "postgres", "0004_add_email.down.sql"),
+		filepath.Join(dir, "sqlite", "0004_add_email.up.sql"),
+		filepath.Join(dir, "sqlite", "0004_add_email.down.sql"),
+	}
+	if strings.Join(paths, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected %v, got %v", want, paths)
+	}
+}
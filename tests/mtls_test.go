@@ -0,0 +1,238 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"student-server/auth"
+	"student-server/config"
+	"student-server/tlsconfig"
+)
+
+// testCA issues client certificates for tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Partner CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+// writeBundle writes the CA certificate to a file and returns its path
+func (ca *testCA) writeBundle(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "client-ca.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// issue returns a client certificate for subject signed by the CA
+func (ca *testCA) issue(t *testing.T, subject *x509.Certificate) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject.SerialNumber = big.NewInt(time.Now().UnixNano())
+	subject.NotBefore = time.Now().Add(-time.Hour)
+	subject.NotAfter = time.Now().Add(time.Hour)
+	subject.KeyUsage = x509.KeyUsageDigitalSignature
+	subject.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	der, err := x509.CreateCertificate(rand.Reader, subject, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// verified returns the connection state of a client that presented cert
+// and had it verified
+func verified(cert tls.Certificate) *tls.ConnectionState {
+	return &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert.Leaf},
+		VerifiedChains:   [][]*x509.Certificate{{cert.Leaf}},
+	}
+}
+
+func TestAuthenticateClientCert(t *testing.T) {
+	ca := newTestCA(t)
+	spiffe, _ := url.Parse("spiffe://partner.example/billing")
+	cert := ca.issue(t, &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "billing-service"},
+		DNSNames:       []string{"billing.partner.example"},
+		URIs:           []*url.URL{spiffe},
+		EmailAddresses: []string{"ops@partner.example"},
+	})
+	t.Cleanup(func() { auth.SetClientCertRules(nil) })
+
+	tests := []struct {
+		rule            auth.ClientCertRule
+		principal, role string
+		ok              bool
+	}{
+		{auth.ClientCertRule{Match: "cn:billing-service", Role: "partner"}, "billing-service", "partner", true},
+		{auth.ClientCertRule{Match: "dns:BILLING.partner.example", Principal: "billing"}, "billing", "", true},
+		{auth.ClientCertRule{Match: "uri:spiffe://partner.example/billing", Principal: "billing", Role: "reader"}, "billing", "reader", true},
+		{auth.ClientCertRule{Match: "email:ops@partner.example"}, "ops@partner.example", "", true},
+		{auth.ClientCertRule{Match: "cn:someone-else"}, "", "", false},
+	}
+	for _, tt := range tests {
+		auth.SetClientCertRules([]auth.ClientCertRule{tt.rule})
+		principal, role, ok := auth.AuthenticateTLS(verified(cert))
+		if principal != tt.principal || role != tt.role || ok != tt.ok {
+			t.Errorf("%s: got %q %q %v", tt.rule.Match, principal, role, ok)
+		}
+	}
+
+	// Certificates the TLS handshake didn't verify are never accepted
+	auth.SetClientCertRules([]auth.ClientCertRule{{Match: "cn:billing-service"}})
+	if _, _, ok := auth.AuthenticateTLS(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert.Leaf}}); ok {
+		t.Error("accepted an unverified certificate")
+	}
+	if _, _, ok := auth.AuthenticateTLS(nil); ok {
+		t.Error("accepted a plain HTTP request")
+	}
+}
+
+func TestClientCertMiddleware(t *testing.T) {
+	ca := newTestCA(t)
+	cert := ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "billing-service"}})
+	auth.SetClientCertRules([]auth.ClientCertRule{{Match: "cn:billing-service", Principal: "billing", Role: "partner"}})
+	t.Cleanup(func() { auth.SetClientCertRules(nil) })
+
+	handler := auth.BasicAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := auth.UserFromContext(r.Context())
+		role, _ := auth.RoleFromContext(r.Context())
+		fmt.Fprintf(w, "%s/%s", user, role)
+	}))
+
+	req := httptest.NewRequest("GET", "/students", nil)
+	req.TLS = verified(cert)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Body.String() != "billing/partner" {
+		t.Errorf("got %d %q", rr.Code, rr.Body.String())
+	}
+
+	// An unmapped certificate falls back to basic auth
+	other := ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "unknown"}})
+	req = httptest.NewRequest("GET", "/students", nil)
+	req.TLS = verified(other)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an unmapped certificate, got %d", rr.Code)
+	}
+	req.SetBasicAuth("admin", "password123")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Body.String() != "admin/" {
+		t.Errorf("got %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestMutualTLSServer(t *testing.T) {
+	ca := newTestCA(t)
+	certs, err := tlsconfig.NewCertReloader(writeCert(t, t.TempDir(), 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := tlsconfig.DefaultConfig()
+	cfg.ClientAuth = tlsconfig.ClientAuthRequire
+	cfg.ClientCA = ca.writeBundle(t)
+	auth.SetClientCertRules([]auth.ClientCertRule{{Match: "cn:billing-service", Role: "partner"}})
+	t.Cleanup(func() { auth.SetClientCertRules(nil) })
+
+	handler := auth.BasicAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := auth.UserFromContext(r.Context())
+		io.WriteString(w, user)
+	}))
+	addr, client := serveTLS(t, handler, certs, cfg)
+
+	// Without a client certificate the handshake fails
+	if resp, err := client.Get("https://" + addr + "/"); err == nil {
+		resp.Body.Close()
+		t.Fatal("expected the request without a client certificate to fail")
+	}
+
+	transport := client.Transport.(*http.Transport)
+	transport.TLSClientConfig.Certificates = []tls.Certificate{ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "billing-service"}})}
+	resp, err := client.Get("https://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "billing-service" {
+		t.Errorf("got %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestClientCertConfigValidate(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.ClientCerts = []auth.ClientCertRule{{Match: "serial:42"}}
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"serial:42", "auth.client_certs needs"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error doesn't mention %s: %v", want, err)
+		}
+	}
+
+	cfg = config.Default()
+	cfg.TLS.ClientAuth = "sometimes"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "client_auth") {
+		t.Errorf("expected an unknown client_auth mode to be rejected, got %v", err)
+	}
+	cfg.TLS.ClientAuth = tlsconfig.ClientAuthRequire
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "client_ca") {
+		t.Errorf("expected client_auth without a CA bundle to be rejected, got %v", err)
+	}
+}
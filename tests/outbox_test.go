@@ -0,0 +1,334 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"student-server/database"
+	"student-server/events"
+	"student-server/models"
+	"student-server/outbox"
+)
+
+// recordingSink remembers published events and can be told to fail, for
+// every event or just one
+type recordingSink struct {
+	name     string
+	fail     bool
+	failID   uint
+	received []outbox.Message
+}
+
+func (s *recordingSink) Name() string {
+	if s.name == "" {
+		return "recording"
+	}
+	return s.name
+}
+
+func (s *recordingSink) Publish(_ context.Context, msg outbox.Message) error {
+	if s.fail || msg.ID == s.failID {
+		return errors.New("sink unavailable")
+	}
+	s.received = append(s.received, msg)
+	return nil
+}
+
+func TestOutboxRecordsEventsWithWrites(t *testing.T) {
+	db := newTestDB(t)
+
+	student := models.Student{Name: "Al Mamun", Age: 20, Grade: "A"}
+	if err := database.CreateStudent(context.Background(), db, &student); err != nil {
+		t.Fatal(err)
+	}
+	student.Grade = "A+"
+	if err := database.UpdateStudent(context.Background(), db, &student); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DeleteStudent(context.Background(), db, &student); err != nil {
+		t.Fatal(err)
+	}
+
+	sink := &recordingSink{}
+	relay := outbox.NewRelay(db, sink)
+	n, err := relay.PublishPending(context.Background())
+	if err != nil || n != 3 {
+		t.Fatalf("Expected 3 published events, got %d (%v)", n, err)
+	}
+
+	want := []events.Type{events.StudentCreated, events.StudentUpdated, events.StudentDeleted}
+	for i, msg := range sink.received {
+		if msg.Type != want[i] || msg.Student.ID != student.ID {
+			t.Errorf("Event %d: expected %s for student %d, got %s for %d", i, want[i], student.ID, msg.Type, msg.Student.ID)
+		}
+	}
+	if sink.received[1].Student.Grade != "A+" {
+		t.Errorf("Expected update event to carry the new grade, got %q", sink.received[1].Student.Grade)
+	}
+
+	// Everything is published, so nothing is sent twice
+	if n, _ := relay.PublishPending(context.Background()); n != 0 {
+		t.Errorf("Expected nothing left to publish, got %d", n)
+	}
+}
+
+func TestOutboxRollsBackStudentWrite(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.Migrator().DropTable(&models.OutboxEvent{}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := database.CreateStudent(context.Background(), db, &models.Student{Name: "Efaz", Age: 22, Grade: "B"})
+	if err == nil {
+		t.Fatal("Expected the write to fail without an outbox table")
+	}
+
+	var count int64
+	db.Model(&models.Student{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Student was written without its event")
+	}
+}
+
+func TestOutboxRetriesFailedSink(t *testing.T) {
+	db := newTestDB(t)
+	database.CreateStudent(context.Background(), db, &models.Student{Name: "Al Mamun", Age: 20, Grade: "A"})
+	database.CreateStudent(context.Background(), db, &models.Student{Name: "Efaz", Age: 22, Grade: "B"})
+
+	sink := &recordingSink{fail: true}
+	relay := outbox.NewRelay(db, sink)
+	if n, err := relay.PublishPending(context.Background()); err == nil || n != 0 {
+		t.Fatalf("Expected failure, got %d published (%v)", n, err)
+	}
+
+	var first models.OutboxEvent
+	db.Order("id").First(&first)
+	if first.Attempts != 1 || first.PublishedAt != nil || !strings.Contains(first.LastError, "sink unavailable") {
+		t.Errorf("Unexpected outbox row after failure %+v", first)
+	}
+
+	sink.fail = false
+	if n, err := relay.PublishPending(context.Background()); err != nil || n != 2 {
+		t.Fatalf("Expected 2 published events, got %d (%v)", n, err)
+	}
+	if sink.received[0].Student.Name != "Al Mamun" || sink.received[1].Student.Name != "Efaz" {
+		t.Errorf("Events were published out of order")
+	}
+}
+
+func TestOutboxSinksProgressIndependently(t *testing.T) {
+	db := newTestDB(t)
+	database.CreateStudent(context.Background(), db, &models.Student{Name: "Al Mamun", Age: 20, Grade: "A"})
+	database.CreateStudent(context.Background(), db, &models.Student{Name: "Efaz", Age: 22, Grade: "B"})
+
+	healthy := &recordingSink{name: "healthy"}
+	down := &recordingSink{name: "down", fail: true}
+	relay := outbox.NewRelay(db, healthy, down)
+	for i := 0; i < 3; i++ {
+		if n, err := relay.PublishPending(context.Background()); err == nil || n != 0 {
+			t.Fatalf("Expected the down sink to fail, got %d published (%v)", n, err)
+		}
+	}
+	// The healthy sink got every event once, however often the other failed
+	if len(healthy.received) != 2 {
+		t.Fatalf("Expected the healthy sink to get 2 events once each, got %d", len(healthy.received))
+	}
+
+	down.fail = false
+	if n, err := relay.PublishPending(context.Background()); err != nil || n != 2 {
+		t.Fatalf("Expected 2 published events, got %d (%v)", n, err)
+	}
+	if len(healthy.received) != 2 || len(down.received) != 2 || down.received[0].Student.Name != "Al Mamun" {
+		t.Errorf("Unexpected deliveries: healthy %d, down %d", len(healthy.received), len(down.received))
+	}
+}
+
+func TestOutboxParksPoisonEvents(t *testing.T) {
+	db := newTestDB(t)
+	database.CreateStudent(context.Background(), db, &models.Student{Name: "Al Mamun", Age: 20, Grade: "A"})
+	db.Create(&models.OutboxEvent{EventType: string(events.StudentCreated), Payload: "not json"})
+	database.CreateStudent(context.Background(), db, &models.Student{Name: "Efaz", Age: 22, Grade: "B"})
+
+	// The sink keeps rejecting the first event
+	sink := &recordingSink{failID: 1}
+	relay := outbox.NewRelay(db, sink)
+	relay.MaxAttempts = 2
+	relay.PublishPending(context.Background())
+	if len(sink.received) != 0 {
+		t.Fatalf("Expected nothing to pass the failing event yet, got %d", len(sink.received))
+	}
+	if n, err := relay.PublishPending(context.Background()); err != nil || n != 1 {
+		t.Fatalf("Expected the last event to be published, got %d (%v)", n, err)
+	}
+	if len(sink.received) != 1 || sink.received[0].Student.Name != "Efaz" {
+		t.Errorf("Unexpected deliveries %+v", sink.received)
+	}
+
+	// Both the rejected and the malformed event are parked, not published
+	var parked []models.OutboxDelivery
+	db.Where("parked_at IS NOT NULL").Order("event_id").Find(&parked)
+	if len(parked) != 2 || parked[0].Attempts != 2 || parked[1].Attempts != 1 || !strings.Contains(parked[1].LastError, "malformed") {
+		t.Errorf("Unexpected parked events %+v", parked)
+	}
+	var unpublished int64
+	db.Model(&models.OutboxEvent{}).Where("published_at IS NULL").Count(&unpublished)
+	if unpublished != 2 {
+		t.Errorf("Expected the parked events to stay unpublished, got %d", unpublished)
+	}
+}
+
+func TestOutboxTailer(t *testing.T) {
+	db := newTestDB(t)
+	var got []string
+	tailer := outbox.NewTailer(db, func(_ context.Context, msg outbox.Message) {
+		got = append(got, fmt.Sprintf("%d:%s", msg.ID, msg.Student.Name))
+	})
+	tailer.GapTimeout = time.Hour
+	event := func(id uint, name string) {
+		t.Helper()
+		payload := `{"type":"student.created","student":{"name":"` + name + `"}}`
+		if err := db.Create(&models.OutboxEvent{ID: id, EventType: string(events.StudentCreated), Payload: payload}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Event 2's write commits after event 3's
+	event(1, "Al Mamun")
+	event(3, "Ratul")
+	tailer.Poll(context.Background())
+	event(2, "Efaz")
+	tailer.Poll(context.Background())
+	event(4, "Nadia")
+	tailer.Poll(context.Background())
+	if want := "1:Al Mamun 3:Ratul 2:Efaz 4:Nadia"; strings.Join(got, " ") != want {
+		t.Errorf("Expected %s, got %v", want, got)
+	}
+
+	// A write that rolled back leaves a gap that is given up on in time
+	got = nil
+	event(6, "Tania")
+	tailer.Poll(context.Background())
+	tailer.GapTimeout = 0
+	tailer.Poll(context.Background())
+	event(7, "Rafi")
+	tailer.Poll(context.Background())
+	if want := "6:Tania 7:Rafi"; strings.Join(got, " ") != want {
+		t.Errorf("Expected %s, got %v", want, got)
+	}
+}
+
+func TestEventsResumeFromOutbox(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	for _, name := range []string{"Al Mamun", "Efaz", "Ratul"} {
+		if err := database.CreateStudent(ctx, db, &models.Student{Name: name, Age: 20, Grade: "A"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// One instance's feed carries the outbox IDs
+	first := events.NewBroker(10)
+	outbox.NewTailer(db, func(_ context.Context, msg outbox.Message) { first.Add(msg.Event()) }).Poll(ctx)
+	sub, missed, complete := first.Subscribe(2, 10)
+	first.Unsubscribe(sub)
+	if !complete || len(missed) != 1 || missed[0].ID != 3 || missed[0].Student.Name != "Ratul" {
+		t.Errorf("Expected event 3 from the history, got %v %+v", complete, missed)
+	}
+
+	// Another instance, or this one after a restart, replays from the outbox
+	second := events.NewBroker(10)
+	second.Backlog = outbox.Backlog(db)
+	sub, missed, complete, err := second.Resume(ctx, 2, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.Unsubscribe(sub)
+	if !complete || len(missed) != 1 || missed[0].ID != 3 || missed[0].Student.Name != "Ratul" {
+		t.Errorf("Expected event 3 from the outbox, got %v %+v", complete, missed)
+	}
+
+	// IDs the outbox never had, and more missed events than the history
+	// holds, mean a resync
+	sub, _, complete, _ = second.Resume(ctx, 42, 10)
+	second.Unsubscribe(sub)
+	if complete {
+		t.Error("Expected an unknown ID to need a resync")
+	}
+	small := events.NewBroker(1)
+	small.Backlog = outbox.Backlog(db)
+	sub, _, complete, _ = small.Resume(ctx, 1, 10)
+	small.Unsubscribe(sub)
+	if complete {
+		t.Error("Expected too many missed events to need a resync")
+	}
+}
+
+// fakeNATS accepts one connection and reports every published message
+func fakeNATS(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	published := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, "INFO {\"server_id\":\"fake\",\"headers\":true}\r\n")
+
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			switch fields[0] {
+			case "PING":
+				fmt.Fprint(conn, "PONG\r\n")
+			case "HPUB":
+				total, _ := strconv.Atoi(fields[3])
+				body := make([]byte, total+2)
+				io.ReadFull(r, body)
+				published <- fields[1] + " " + string(body[:total])
+			}
+		}
+	}()
+	return "nats://" + listener.Addr().String(), published
+}
+
+func TestNATSSink(t *testing.T) {
+	url, published := fakeNATS(t)
+	sink := outbox.NewNATSSink(url, "school.students")
+	defer sink.Close()
+
+	msg := outbox.Message{ID: 7, Payload: []byte(`{"type":"student.updated"}`)}
+	msg.Type = events.StudentUpdated
+	if err := sink.Publish(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	got := <-published
+	if !strings.HasPrefix(got, "school.students.updated NATS/1.0\r\nNats-Msg-Id: outbox-7\r\n") {
+		t.Errorf("Unexpected published message %q", got)
+	}
+	if !strings.HasSuffix(got, `{"type":"student.updated"}`) {
+		t.Errorf("Payload missing from %q", got)
+	}
+}
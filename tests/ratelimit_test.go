@@ -0,0 +1,255 @@
+package tests
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"student-server/auth"
+	"student-server/config"
+	"student-server/grpcserver"
+	"student-server/models"
+	"student-server/ratelimit"
+	pb "student-server/studentpb"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// limitedHandler returns a handler that allows burst requests per hour in
+// the students group, counted by key
+func limitedHandler(t *testing.T, store ratelimit.Store, key string, proxies ...string) (*ratelimit.Limiter, http.Handler) {
+	t.Helper()
+	c := ratelimit.DefaultConfig()
+	c.TrustedProxies = proxies
+	c.Groups[ratelimit.GroupStudents] = ratelimit.Limit{Requests: 2, Per: time.Hour, Key: key}
+	limiter, err := ratelimit.New(c, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	return limiter, limiter.Middleware(ratelimit.GroupStudents)(ok)
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	_, handler := limitedHandler(t, ratelimit.NewMemoryStore(), ratelimit.KeyPrincipal)
+	request := func(user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/students", nil)
+		req = req.WithContext(auth.WithUser(req.Context(), user))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i, remaining := range []string{"1", "0"} {
+		rr := request("alice")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected 200, got %d", i+1, rr.Code)
+		}
+		if rr.Header().Get("RateLimit-Limit") != "2" || rr.Header().Get("RateLimit-Remaining") != remaining {
+			t.Errorf("Request %d: unexpected headers %v", i+1, rr.Header())
+		}
+	}
+
+	rr := request("alice")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", rr.Code)
+	}
+	// One token comes back every 30 minutes
+	if retry, _ := strconv.Atoi(rr.Header().Get("Retry-After")); retry < 1790 || retry > 1800 {
+		t.Errorf("Unexpected Retry-After %q", rr.Header().Get("Retry-After"))
+	}
+	if reset, _ := strconv.Atoi(rr.Header().Get("RateLimit-Reset")); reset < 3590 || reset > 3600 {
+		t.Errorf("Unexpected RateLimit-Reset %q", rr.Header().Get("RateLimit-Reset"))
+	}
+
+	// Other principals have their own buckets
+	if rr := request("bob"); rr.Code != http.StatusOK {
+		t.Errorf("Expected another user to be allowed, got %d", rr.Code)
+	}
+}
+
+func TestRateLimitRefills(t *testing.T) {
+	c := ratelimit.DefaultConfig()
+	c.Groups[ratelimit.GroupDefault] = ratelimit.Limit{Requests: 1, Per: 50 * time.Millisecond, Key: ratelimit.KeyIP}
+	now := time.Now()
+	store := ratelimit.NewMemoryStore()
+	store.Now = func() time.Time { return now }
+	limiter, err := ratelimit.New(c, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := limiter.Middleware(ratelimit.GroupWebhooks)(http.NotFoundHandler())
+
+	codes := func() int {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/webhooks", nil))
+		return rr.Code
+	}
+	if codes() != http.StatusNotFound || codes() != http.StatusTooManyRequests {
+		t.Fatal("Expected the second request to be limited by the default group")
+	}
+	now = now.Add(60 * time.Millisecond)
+	if code := codes(); code != http.StatusNotFound {
+		t.Errorf("Expected the bucket to refill, got %d", code)
+	}
+
+	// Turning limits off takes effect straight away
+	codes()
+	c.Enabled = false
+	if err := limiter.SetConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	if code := codes(); code != http.StatusNotFound {
+		t.Errorf("Expected no limit once disabled, got %d", code)
+	}
+}
+
+func TestRateLimitByAPIKey(t *testing.T) {
+	// httptest requests come from 192.0.2.1, the gateway here
+	_, handler := limitedHandler(t, ratelimit.NewMemoryStore(), ratelimit.KeyAPIKey, "192.0.2.1")
+	request := func(remote, apiKey string) int {
+		req := httptest.NewRequest("GET", "/students", nil)
+		req.RemoteAddr = remote
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	const gateway = "192.0.2.1:1234"
+	request(gateway, "key-1")
+	request(gateway, "key-1")
+	if code := request(gateway, "key-1"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected key-1 to be limited, got %d", code)
+	}
+	if code := request(gateway, "key-2"); code != http.StatusOK {
+		t.Errorf("Expected key-2 to have its own bucket, got %d", code)
+	}
+	if code := request(gateway, ""); code != http.StatusOK {
+		t.Errorf("Expected requests without a key to be counted by IP, got %d", code)
+	}
+
+	// A client talking to the server directly can't get a fresh bucket by
+	// making up keys
+	const direct = "203.0.113.7:4000"
+	request(direct, "made-up-1")
+	request(direct, "made-up-2")
+	if code := request(direct, "made-up-3"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected keys from untrusted clients to be ignored, got %d", code)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	limiter, _ := limitedHandler(t, ratelimit.NewMemoryStore(), ratelimit.KeyIP, "10.0.0.0/8", "192.168.1.1")
+	tests := []struct {
+		remote, forwarded, want string
+	}{
+		{"203.0.113.7:4000", "", "203.0.113.7"},
+		// Only trusted proxies may name the client
+		{"203.0.113.7:4000", "198.51.100.1", "203.0.113.7"},
+		{"10.1.2.3:4000", "198.51.100.1", "198.51.100.1"},
+		// Addresses a client put in front of the proxy's are ignored
+		{"10.1.2.3:4000", "1.1.1.1, 198.51.100.1, 192.168.1.1", "198.51.100.1"},
+		{"10.1.2.3:4000", "10.0.0.1", "10.0.0.1"},
+		{"10.1.2.3:4000", "garbage, 198.51.100.1", "198.51.100.1"},
+		{"[::ffff:10.1.2.3]:4000", "2001:db8::1", "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if got := limiter.ClientIP(req); got != tt.want {
+			t.Errorf("%s %q: got %s, want %s", tt.remote, tt.forwarded, got, tt.want)
+		}
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("store unreachable")
+}
+
+func TestRateLimitStoreFailureAllows(t *testing.T) {
+	_, handler := limitedHandler(t, failingStore{}, ratelimit.KeyIP)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/students", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected the request to be allowed, got %d", rr.Code)
+	}
+}
+
+func TestRateLimitConfigValidate(t *testing.T) {
+	cfg := config.Default()
+	cfg.RateLimit.TrustedProxies = []string{"10.0.0.0/33"}
+	cfg.RateLimit.Groups["student"] = ratelimit.Limit{Requests: 1, Per: time.Second}
+	cfg.RateLimit.Groups[ratelimit.GroupGraphQL] = ratelimit.Limit{Requests: 10, Key: "cookie"}
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	for _, want := range []string{"10.0.0.0/33", `"student"`, "groups.graphql", "per must be positive", `"cookie"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Error doesn't mention %s: %v", want, err)
+		}
+	}
+
+	// Without a gateway nobody vouches for the keys
+	cfg = config.Default()
+	cfg.RateLimit.Groups[ratelimit.GroupGraphQL] = ratelimit.Limit{Requests: 10, Per: time.Second, Key: ratelimit.KeyAPIKey}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "trusted_proxies") {
+		t.Errorf("Expected api_key limits to need trusted proxies, got %v", err)
+	}
+}
+
+func TestGRPCRateLimit(t *testing.T) {
+	c := ratelimit.DefaultConfig()
+	c.Groups[ratelimit.GroupAuth] = ratelimit.Limit{Requests: 3, Per: time.Hour, Key: ratelimit.KeyIP}
+	c.Groups[ratelimit.GroupStudents] = ratelimit.Limit{Requests: 1, Per: time.Hour}
+	limiter, err := ratelimit.New(c, ratelimit.NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcserver.SetRateLimiter(limiter)
+	defer grpcserver.SetRateLimiter(nil)
+
+	conn := dialGRPCWith(t, setupStudents(t, models.Student{Name: "Al Mamun", Age: 20, Grade: "A"}))
+	client := pb.NewStudentServiceClient(conn)
+	get := func(userpass string) codes.Code {
+		creds := base64.StdEncoding.EncodeToString([]byte(userpass))
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Basic "+creds)
+		_, err := client.GetStudent(ctx, &pb.GetStudentRequest{Id: 1})
+		return status.Code(err)
+	}
+
+	if code := get("admin:password123"); code != codes.OK {
+		t.Fatalf("Expected the first call to be allowed, got %v", code)
+	}
+	if code := get("admin:password123"); code != codes.ResourceExhausted {
+		t.Errorf("Expected the students limit to apply, got %v", code)
+	}
+	// Failed attempts count against the address before authentication
+	if code := get("admin:guess"); code != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated, got %v", code)
+	}
+	if code := get("admin:guess"); code != codes.ResourceExhausted {
+		t.Errorf("Expected password guessing to be limited, got %v", code)
+	}
+
+	// Health checks are never limited
+	if _, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Errorf("Expected health checks to be allowed, got %v", err)
+	}
+}
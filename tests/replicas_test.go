@@ -0,0 +1,157 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"student-server/auth"
+	"student-server/database"
+	"student-server/handlers"
+	"student-server/logging"
+	"student-server/models"
+
+	"gorm.io/gorm"
+)
+
+func closeDB(db *gorm.DB) {
+	sqlDB, _ := db.DB()
+	sqlDB.Close()
+}
+
+func TestClusterRoundRobinAndFallback(t *testing.T) {
+	primary, replica1, replica2 := openTestDB(t), openTestDB(t), openTestDB(t)
+	cluster := database.NewCluster(primary, replica1, replica2)
+
+	// Replicas are only used once a health check has seen them
+	if cluster.Reader() != primary {
+		t.Error("Expected unchecked replicas to be skipped")
+	}
+
+	cluster.CheckReplicas(context.Background())
+	first, second, third := cluster.Reader(), cluster.Reader(), cluster.Reader()
+	if first == primary || second == primary || first == second || first != third {
+		t.Error("Expected reads to alternate between the replicas")
+	}
+
+	closeDB(replica1)
+	cluster.CheckReplicas(context.Background())
+	for i := 0; i < 3; i++ {
+		if cluster.Reader() != replica2 {
+			t.Fatal("Expected reads to avoid the replica that is down")
+		}
+	}
+
+	closeDB(replica2)
+	cluster.CheckReplicas(context.Background())
+	if cluster.Reader() != primary {
+		t.Error("Expected reads to fall back to the primary")
+	}
+}
+
+func TestGetHandlersReadFromReplicas(t *testing.T) {
+	primary := setupStudents(t, models.Student{Name: "On Primary", Age: 20, Grade: "A"})
+	replica := newTestDB(t)
+	database.CreateStudent(context.Background(), replica, &models.Student{Name: "On Replica", Age: 20, Grade: "A"})
+
+	cluster := database.NewCluster(primary, replica)
+	cluster.CheckReplicas(context.Background())
+	handlers.SetReadReplicas(cluster)
+	defer handlers.SetReadReplicas(nil)
+
+	window := handlers.PrimaryReadWindow
+	handlers.PrimaryReadWindow = 200 * time.Millisecond
+	defer func() { handlers.PrimaryReadWindow = window }()
+
+	router := studentRouter()
+	nameOf := func(header string) string {
+		req := httptest.NewRequest("GET", "/students/1", nil)
+		if header != "" {
+			req.Header.Set(handlers.ReadConsistencyHeader, header)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var student models.Student
+		json.NewDecoder(rr.Body).Decode(&student)
+		return student.Name
+	}
+
+	if name := nameOf(""); name != "On Replica" {
+		t.Errorf("Expected GET to read from the replica, got %q", name)
+	}
+	if name := nameOf("primary"); name != "On Primary" {
+		t.Errorf("Expected %s: primary to read from the primary, got %q", handlers.ReadConsistencyHeader, name)
+	}
+
+	// A write sends the client's reads to the primary for a while
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("PUT", "/students/1", strings.NewReader(`{"name": "Updated", "age": 21, "grade": "A"}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Update failed with %d", rr.Code)
+	}
+	if name := nameOf(""); name != "Updated" {
+		t.Errorf("Expected to read our own write from the primary, got %q", name)
+	}
+
+	time.Sleep(handlers.PrimaryReadWindow)
+	if name := nameOf(""); name != "On Replica" {
+		t.Errorf("Expected reads to return to the replica, got %q", name)
+	}
+}
+
+func TestPrimaryReadWindowsArePruned(t *testing.T) {
+	primary := setupStudents(t, models.Student{Name: "Writer", Age: 20, Grade: "A"})
+	cluster := database.NewCluster(primary, newTestDB(t))
+	handlers.SetReadReplicas(cluster)
+	defer handlers.SetReadReplicas(nil)
+
+	window := handlers.PrimaryReadWindow
+	handlers.PrimaryReadWindow = 20 * time.Millisecond
+	defer func() { handlers.PrimaryReadWindow = window }()
+
+	router := studentRouter()
+	writeAs := func(user string) {
+		req := httptest.NewRequest("PUT", "/students/1", strings.NewReader(`{"name": "Writer", "age": 21, "grade": "A"}`))
+		req = req.WithContext(auth.WithUser(req.Context(), user))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Update failed with %d", rr.Code)
+		}
+	}
+
+	for i := 0; i < 50; i++ {
+		writeAs(fmt.Sprintf("writer-%d", i))
+	}
+	// Once their windows have passed, the next write sweeps them out
+	deadline := time.Now().Add(5 * time.Second)
+	for handlers.TrackedWriters() > 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected expired writers to be pruned, %d left", handlers.TrackedWriters())
+		}
+		time.Sleep(5 * time.Millisecond)
+		writeAs("latest")
+	}
+}
+
+func TestReplicasLogThroughSlog(t *testing.T) {
+	primary := openTestDB(t)
+	// Nothing listens on port 1, so the replica is opened but stays down
+	cluster, err := database.OpenCluster(primary, database.Config{Replicas: []string{"postgres://u:p@127.0.0.1:1/db"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Close()
+
+	if _, ok := cluster.Replicas[0].DB.Logger.(*logging.GormLogger); !ok {
+		t.Errorf("Expected replica queries to be logged through slog, got %T", cluster.Replicas[0].DB.Logger)
+	}
+	if cluster.Replicas[0].Healthy() {
+		t.Error("Expected the unreachable replica to be unhealthy")
+	}
+}
@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"student-server/config"
+	"student-server/events"
+	"student-server/handlers"
+	"student-server/middleware"
+	"student-server/models"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestMaxBodySize(t *testing.T) {
+	handler := middleware.MaxBodySize(32)(http.HandlerFunc(handlers.AddStudentHandler))
+	body := `{"name": "` + strings.Repeat("a", 64) + `", "age": 20, "grade": "A"}`
+
+	// A declared length over the limit is refused up front
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/students", strings.NewReader(body)))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a large body, got %d", rr.Code)
+	}
+
+	// A chunked body fails once it has been read past the limit
+	req := httptest.NewRequest("POST", "/students", io.MultiReader(strings.NewReader(body)))
+	req.ContentLength = -1
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a large chunked body, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/students", strings.NewReader("{")))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a small malformed body, got %d", rr.Code)
+	}
+}
+
+func TestEventStreamOutlivesWriteTimeout(t *testing.T) {
+	broker := events.NewBroker(10)
+	handlers.SetEventBroker(broker)
+	t.Cleanup(handlers.ReopenStreams)
+
+	interval := handlers.HeartbeatInterval
+	handlers.HeartbeatInterval = 20 * time.Millisecond
+	defer func() { handlers.HeartbeatInterval = interval }()
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(handlers.StudentEventsHandler))
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	opened := time.Now()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	// Heartbeats keep arriving until well past the write timeout
+	timeout := time.After(2 * time.Second)
+	for time.Since(opened) < 2*server.Config.WriteTimeout {
+		select {
+		case _, ok := <-lines:
+			if !ok {
+				t.Fatal("The event stream ended at the write timeout")
+			}
+		case <-timeout:
+			t.Fatal("Timed out waiting for heartbeats")
+		}
+	}
+
+	// Events published after the write timeout still arrive
+	broker.Publish(events.StudentCreated, models.Student{Name: "Efaz"})
+	for event := false; !event; {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("The event stream ended before the event")
+			}
+			if line == "" || strings.HasPrefix(line, ":") {
+				continue // heartbeats
+			}
+			if line != "id: 1" {
+				t.Errorf("Unexpected line %q", line)
+			}
+			event = true
+		case <-timeout:
+			t.Fatal("Timed out waiting for the event")
+		}
+	}
+
+	// Closing streams ends the response
+	handlers.CloseStreams()
+	timeout = time.After(2 * time.Second)
+	for {
+		select {
+		case _, ok := <-lines:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("The event stream was not closed")
+		}
+	}
+}
+
+func TestCloseStreamsClosesWebSockets(t *testing.T) {
+	handlers.SetEventBroker(events.NewBroker(10))
+	t.Cleanup(handlers.ReopenStreams)
+
+	header := http.Header{}
+	header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("admin:password123")))
+	conn, _, err := dialWebSocket(t, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	handlers.CloseStreams()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway {
+		t.Errorf("Expected a going away close frame, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := handlers.WaitForWebSockets(ctx); err != nil {
+		t.Errorf("WebSocket handler didn't finish: %v", err)
+	}
+}
+
+func TestServerLimitsValidate(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.ReadTimeout = -time.Second
+	cfg.Server.MaxBodyBytes = -1
+	cfg.Server.ShutdownTimeout = 0
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	for _, want := range []string{"timeouts", "max_body_bytes", "shutdown_timeout"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Error doesn't mention %s: %v", want, err)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package tests
+
+import (
+	"testing"
+
+	"student-server/database"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB opens a fresh in-memory SQLite database with the server's
+// migrations applied
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := openTestDB(t)
+	if _, err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// openTestDB opens a fresh, empty in-memory SQLite database
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	cfg := database.DefaultConfig()
+	cfg.Driver = database.DriverSQLite
+	cfg.Path = ":memory:"
+	db, err := database.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Logger = logger.Default.LogMode(logger.Silent)
+
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
@@ -0,0 +1,280 @@
+package tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"student-server/config"
+	"student-server/grpcserver"
+	"student-server/middleware"
+	"student-server/tlsconfig"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// writeCert writes a self-signed certificate for localhost with the given
+// serial number and its key to cert.pem and key.pem in dir
+func writeCert(t *testing.T, dir string, serial int64) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Make sure the change is visible even with coarse file timestamps
+	later := time.Now().Add(time.Duration(serial) * time.Second)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+	return certFile, keyFile
+}
+
+// serveTLS serves handler over TLS with the server's TLS settings for cfg and
+// returns its address and a client that trusts its certificate
+func serveTLS(t *testing.T, handler http.Handler, certs *tlsconfig.CertReloader, cfg tlsconfig.Config) (string, *http.Client) {
+	t.Helper()
+	tlsConfig, err := tlsconfig.ServerConfig(cfg, certs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: handler, TLSConfig: tlsConfig}
+	if err := http2.ConfigureServer(server, &http2.Server{}); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ServeTLS(listener, "", "")
+	t.Cleanup(func() { server.Close() })
+
+	roots := x509.NewCertPool()
+	roots.AddCert(certs.Certificate())
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: roots},
+		ForceAttemptHTTP2: true,
+	}}
+	return listener.Addr().String(), client
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, 1)
+	certs, err := tlsconfig.NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serial := certs.Certificate().SerialNumber.Int64(); serial != 1 {
+		t.Fatalf("expected serial 1, got %d", serial)
+	}
+
+	writeCert(t, dir, 2)
+	if err := certs.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if serial := certs.Certificate().SerialNumber.Int64(); serial != 2 {
+		t.Errorf("expected the renewed certificate, got serial %d", serial)
+	}
+
+	// A broken renewal keeps the current certificate in use
+	os.WriteFile(certFile, []byte("not a certificate"), 0o644)
+	if err := certs.Reload(); err == nil {
+		t.Error("expected an error for a broken certificate")
+	}
+	if err := certs.SetFiles(filepath.Join(dir, "missing.pem"), keyFile); err == nil {
+		t.Error("expected an error for a missing certificate")
+	}
+	if serial := certs.Certificate().SerialNumber.Int64(); serial != 2 {
+		t.Errorf("expected the previous certificate to stay, got serial %d", serial)
+	}
+}
+
+func TestCertReloaderWatch(t *testing.T) {
+	dir := t.TempDir()
+	certs, err := tlsconfig.NewCertReloader(writeCert(t, dir, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go certs.Watch(ctx, 10*time.Millisecond)
+
+	writeCert(t, dir, 2)
+	deadline := time.Now().Add(2 * time.Second)
+	for certs.Certificate().SerialNumber.Int64() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("the changed files were not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTLSServer(t *testing.T) {
+	dir := t.TempDir()
+	certs, err := tlsconfig.NewCertReloader(writeCert(t, dir, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := middleware.HSTS(24 * time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	addr, client := serveTLS(t, handler, certs, tlsconfig.DefaultConfig())
+
+	resp, err := client.Get("https://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Errorf("expected HTTP/2, got %s", resp.Proto)
+	}
+	if got := resp.Header.Get("Strict-Transport-Security"); got != "max-age=86400; includeSubDomains" {
+		t.Errorf("unexpected HSTS header %q", got)
+	}
+
+	// New connections get the reloaded certificate
+	writeCert(t, dir, 2)
+	if err := certs.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serial := conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64(); serial != 2 {
+		t.Errorf("expected the reloaded certificate, got serial %d", serial)
+	}
+	conn.Close()
+
+	// TLS 1.1 and older are refused
+	if _, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS11}); err == nil {
+		t.Error("expected a TLS 1.1 handshake to fail")
+	}
+}
+
+func TestGRPCOverTLS(t *testing.T) {
+	certs, err := tlsconfig.NewCertReloader(writeCert(t, t.TempDir(), 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig, err := tlsconfig.ServerConfig(tlsconfig.DefaultConfig(), certs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, _ := grpcserver.New(nil, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(certs.Certificate())
+	conn, err := grpc.NewClient(listener.Addr().String(),
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: roots})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("unexpected status %v", resp.Status)
+	}
+}
+
+func TestRedirectHTTPS(t *testing.T) {
+	tests := []struct {
+		host string
+		port int
+		want string
+	}{
+		{"example.com", 443, "https://example.com/students?page=2"},
+		{"example.com:80", 8443, "https://example.com:8443/students?page=2"},
+		{"[::1]:80", 443, "https://[::1]/students?page=2"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/students?page=2", nil)
+		req.Host = tt.host
+		rr := httptest.NewRecorder()
+		middleware.RedirectHTTPS(tt.port).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusPermanentRedirect || rr.Header().Get("Location") != tt.want {
+			t.Errorf("%s: got %d %q want %q", tt.host, rr.Code, rr.Header().Get("Location"), tt.want)
+		}
+	}
+}
+
+func TestHSTSOnlyOverTLS(t *testing.T) {
+	rr := httptest.NewRecorder()
+	middleware.HSTS(time.Hour)(http.NotFoundHandler()).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Header().Get("Strict-Transport-Security") != "" {
+		t.Error("HSTS header sent over plain HTTP")
+	}
+}
+
+func TestTLSConfigValidate(t *testing.T) {
+	cfg := config.Default()
+	cfg.TLS.Cert = "cert.pem"
+	cfg.TLS.MinVersion = "1.0"
+	cfg.TLS.RedirectPort = cfg.Server.Port
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"cert and key", "min_version", "redirect_port"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error doesn't mention %s: %v", want, err)
+		}
+	}
+
+	cfg = config.Default()
+	cfg.TLS.RedirectPort = 80
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected redirecting without TLS to be rejected")
+	}
+}
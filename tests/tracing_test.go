@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"student-server/database"
+	"student-server/handlers"
+	"student-server/models"
+	"student-server/outbox"
+	"student-server/tracing"
+	"student-server/webhooks"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans installs a tracer provider that keeps every span in memory
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func findSpan(spans []sdktrace.ReadOnlySpan, prefix string) sdktrace.ReadOnlySpan {
+	for _, span := range spans {
+		if strings.HasPrefix(span.Name(), prefix) {
+			return span
+		}
+	}
+	return nil
+}
+
+func TestTracingContinuesIncomingTrace(t *testing.T) {
+	recorder := recordSpans(t)
+	db := setupStudents(t, models.Student{Name: "Al Mamun", Age: 20, Grade: "A"})
+	if err := tracing.InstrumentDB(db); err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	router.Use(tracing.Middleware)
+	router.HandleFunc("/students/{id}", handlers.GetStudentByIDHandler).Methods("GET")
+
+	req := httptest.NewRequest("GET", "/students/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	spans := recorder.Ended()
+	server := findSpan(spans, "GET /students/{id}")
+	if server == nil {
+		t.Fatalf("no span for the route template among %d spans", len(spans))
+	}
+	if got := server.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("server span did not continue the incoming trace: %s", got)
+	}
+	if got := server.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("server span parent: got %s want 00f067aa0ba902b7", got)
+	}
+
+	query := findSpan(spans, "gorm.query students")
+	if query == nil {
+		t.Fatal("no span for the students query")
+	}
+	if query.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Error("the query span is not a child of the request span")
+	}
+}
+
+func TestTracingFollowsEventsToWebhooks(t *testing.T) {
+	recorder := recordSpans(t)
+	db := newTestDB(t)
+	handlers.SetDB(db)
+	allowLocalWebhooks(t)
+
+	rc := &receiver{status: http.StatusOK}
+	target := httptest.NewServer(rc)
+	defer target.Close()
+	createWebhook(t, webhookRouter(), `{"url": "`+target.URL+`", "events": ["student.created"]}`)
+
+	// The write happens inside a request span; the event is published and
+	// delivered later, from background workers
+	ctx, request := tracing.Tracer().Start(context.Background(), "POST /students")
+	if err := database.CreateStudent(ctx, db, &models.Student{Name: "Efaz", Age: 22, Grade: "B"}); err != nil {
+		t.Fatal(err)
+	}
+	request.End()
+	traceID := request.SpanContext().TraceID().String()
+
+	dispatcher := webhooks.NewDispatcher(db)
+	relay := outbox.NewRelay(db, outbox.FuncSink{SinkName: "webhooks", Fn: func(ctx context.Context, msg outbox.Message) error {
+		return dispatcher.Enqueue(ctx, msg.Type, msg.Student)
+	}})
+	if _, err := relay.PublishPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := dispatcher.ProcessDue(context.Background()); err != nil || n != 1 {
+		t.Fatalf("Expected 1 delivery attempt, got %d (%v)", n, err)
+	}
+
+	if rc.received != 1 {
+		t.Fatalf("Expected receiver to be called once, got %d", rc.received)
+	}
+	if got := rc.headers[0].Get("traceparent"); !strings.Contains(got, traceID) {
+		t.Errorf("webhook traceparent %q is not part of trace %s", got, traceID)
+	}
+	for _, name := range []string{"outbox.publish student.created", "webhook.deliver student.created"} {
+		span := findSpan(recorder.Ended(), name)
+		if span == nil {
+			t.Errorf("no %q span", name)
+		} else if span.SpanContext().TraceID().String() != traceID {
+			t.Errorf("%q span is in another trace", name)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"student-server/events"
+	"student-server/handlers"
+	"student-server/models"
+	"student-server/webhooks"
+
+	"github.com/gorilla/mux"
+)
+
+// receiver is a local webhook endpoint that records what it was sent
+type receiver struct {
+	mu       sync.Mutex
+	status   int
+	bodies   [][]byte
+	headers  []http.Header
+	received int
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.bodies = append(rc.bodies, body)
+	rc.headers = append(rc.headers, r.Header.Clone())
+	rc.received++
+	w.WriteHeader(rc.status)
+}
+
+func (rc *receiver) setStatus(status int) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.status = status
+}
+
+func webhookRouter() *mux.Router {
+	router := mux.NewRouter()
+	router.HandleFunc("/webhooks", handlers.CreateWebhookHandler).Methods("POST")
+	router.HandleFunc("/webhooks/{id}/deliveries", handlers.GetWebhookDeliveriesHandler).Methods("GET")
+	router.HandleFunc("/webhooks/{id}/deliveries/{deliveryID}", handlers.GetWebhookDeliveryHandler).Methods("GET")
+	router.HandleFunc("/webhooks/{id}/deliveries/{deliveryID}/redeliver", handlers.RedeliverWebhookHandler).Methods("POST")
+	return router
+}
+
+// allowLocalWebhooks lets webhooks reach the test's local receivers
+func allowLocalWebhooks(t *testing.T) {
+	t.Helper()
+	if err := webhooks.SetConfig(webhooks.Config{AllowedNetworks: []string{"127.0.0.1", "::1"}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { webhooks.SetConfig(webhooks.Config{}) })
+}
+
+func createWebhook(t *testing.T, router http.Handler, body string) map[string]interface{} {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/webhooks", strings.NewReader(body)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var created map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	return created
+}
+
+func TestWebhookSignedDelivery(t *testing.T) {
+	db := newTestDB(t)
+	handlers.SetDB(db)
+	allowLocalWebhooks(t)
+	router := webhookRouter()
+
+	rc := &receiver{status: http.StatusOK}
+	target := httptest.NewServer(rc)
+	defer target.Close()
+
+	created := createWebhook(t, router, `{"url": "`+target.URL+`", "events": ["student.created"], "secret": "s3cret"}`)
+	if created["secret"] != "s3cret" {
+		t.Errorf("Expected secret in create response, got %v", created)
+	}
+
+	dispatcher := webhooks.NewDispatcher(db)
+	dispatcher.Enqueue(context.Background(), events.StudentCreated, models.Student{Name: "Al Mamun", Age: 20, Grade: "A"})
+	// Not subscribed to updates, so nothing is queued for this one
+	dispatcher.Enqueue(context.Background(), events.StudentUpdated, models.Student{Name: "Al Mamun", Age: 21, Grade: "A"})
+
+	n, err := dispatcher.ProcessDue(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("Expected 1 delivery attempt, got %d (%v)", n, err)
+	}
+
+	if rc.received != 1 {
+		t.Fatalf("Expected receiver to be called once, got %d", rc.received)
+	}
+	header := rc.headers[0]
+	if header.Get("X-Webhook-Event") != "student.created" {
+		t.Errorf("Unexpected event header %q", header.Get("X-Webhook-Event"))
+	}
+	if err := webhooks.Verify("s3cret", header.Get(webhooks.SignatureHeader), rc.bodies[0], time.Minute); err != nil {
+		t.Errorf("Signature did not verify: %v", err)
+	}
+	if err := webhooks.Verify("wrong", header.Get(webhooks.SignatureHeader), rc.bodies[0], time.Minute); err == nil {
+		t.Error("Signature verified with the wrong secret")
+	}
+
+	var delivery models.WebhookDelivery
+	db.First(&delivery)
+	if delivery.Status != models.DeliverySucceeded || delivery.Attempts != 1 {
+		t.Errorf("Unexpected delivery state %+v", delivery)
+	}
+}
+
+func TestWebhookRetryDeadLetterAndRedeliver(t *testing.T) {
+	db := newTestDB(t)
+	handlers.SetDB(db)
+	allowLocalWebhooks(t)
+	router := webhookRouter()
+
+	rc := &receiver{status: http.StatusInternalServerError}
+	target := httptest.NewServer(rc)
+	defer target.Close()
+
+	createWebhook(t, router, `{"url": "`+target.URL+`"}`)
+
+	dispatcher := webhooks.NewDispatcher(db)
+	dispatcher.MaxAttempts = 3
+	dispatcher.BaseBackoff = 0
+	dispatcher.Enqueue(context.Background(), events.StudentDeleted, models.Student{Name: "Efaz"})
+
+	for i := 0; i < 5; i++ {
+		dispatcher.ProcessDue(context.Background())
+	}
+
+	var delivery models.WebhookDelivery
+	db.First(&delivery)
+	if delivery.Status != models.DeliveryDead || delivery.Attempts != 3 || rc.received != 3 {
+		t.Fatalf("Expected dead delivery after 3 attempts, got %+v (received %d)", delivery, rc.received)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/webhooks/1/deliveries/1", nil))
+	var detail struct {
+		Status     string                  `json:"status"`
+		AttemptLog []models.WebhookAttempt `json:"attempt_log"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &detail)
+	if len(detail.AttemptLog) != 3 || detail.AttemptLog[0].StatusCode != http.StatusInternalServerError {
+		t.Errorf("Unexpected attempt log %+v", detail.AttemptLog)
+	}
+
+	// The receiver recovers and the delivery is redelivered by hand
+	rc.setStatus(http.StatusNoContent)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/webhooks/1/deliveries/1/redeliver", nil))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d", http.StatusAccepted, rr.Code)
+	}
+
+	dispatcher.ProcessDue(context.Background())
+	db.First(&delivery)
+	if delivery.Status != models.DeliverySucceeded {
+		t.Errorf("Expected redelivery to succeed, got %+v", delivery)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/webhooks/1/deliveries/99/redeliver", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestCreateWebhookValidation(t *testing.T) {
+	handlers.SetDB(newTestDB(t))
+	router := webhookRouter()
+
+	for _, body := range []string{
+		`{"url": "ftp://example.com/hook"}`,
+		`{"url": "http://93.184.215.14/hook", "events": ["student.graduated"]}`,
+		`not json`,
+		// Internal addresses are refused, cloud metadata services included
+		`{"url": "http://169.254.169.254/latest/meta-data/"}`,
+		`{"url": "http://127.0.0.1:8080/students"}`,
+		`{"url": "http://localhost/hook"}`,
+		`{"url": "http://10.0.0.5/hook"}`,
+		`{"url": "http://[::ffff:192.168.1.1]/hook"}`,
+		`{"url": "http://[fe80::1]/hook"}`,
+	} {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("POST", "/webhooks", strings.NewReader(body)))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %s, got %d", http.StatusBadRequest, body, rr.Code)
+		}
+	}
+}
+
+func TestWebhookDeliveryRefusesInternalTargets(t *testing.T) {
+	db := newTestDB(t)
+	rc := &receiver{status: http.StatusOK}
+	target := httptest.NewServer(rc)
+	defer target.Close()
+
+	// A subscription stored before the address was refused, or whose host
+	// now resolves somewhere internal, is checked again when dialed
+	db.Create(&models.WebhookSubscription{URL: target.URL, EventTypes: "student.created", Secret: "s3cret", Active: true})
+	dispatcher := webhooks.NewDispatcher(db)
+	dispatcher.Enqueue(context.Background(), events.StudentCreated, models.Student{Name: "Al Mamun"})
+	dispatcher.ProcessDue(context.Background())
+
+	var attempt models.WebhookAttempt
+	db.First(&attempt)
+	if rc.received != 0 || !strings.Contains(attempt.Error, webhooks.ErrForbiddenTarget.Error()) {
+		t.Errorf("Expected the delivery to be refused, got %d received and attempt %+v", rc.received, attempt)
+	}
+}
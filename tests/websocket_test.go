@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"student-server/auth"
+	"student-server/events"
+	"student-server/handlers"
+	"student-server/models"
+
+	"github.com/gorilla/websocket"
+)
+
+type wsReply struct {
+	Type   string        `json:"type"`
+	Topic  string        `json:"topic"`
+	Topics []string      `json:"topics"`
+	Event  *events.Event `json:"event"`
+	Error  string        `json:"error"`
+}
+
+func dialWebSocket(t *testing.T, header http.Header) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+	server := httptest.NewServer(auth.BasicAuthMiddleware(http.HandlerFunc(handlers.WebSocketHandler)))
+	t.Cleanup(server.Close)
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	return websocket.DefaultDialer.Dial(url, header)
+}
+
+func readReply(t *testing.T, conn *websocket.Conn) wsReply {
+	t.Helper()
+	var reply wsReply
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := conn.ReadJSON(&reply); err != nil {
+		t.Fatal(err)
+	}
+	return reply
+}
+
+func TestWebSocketRequiresAuth(t *testing.T) {
+	handlers.SetEventBroker(events.NewBroker(10))
+
+	_, resp, err := dialWebSocket(t, nil)
+	if err == nil {
+		t.Fatal("Expected the upgrade to be rejected")
+	}
+	if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %v", resp)
+	}
+}
+
+func TestWebSocketFilteredSubscriptions(t *testing.T) {
+	broker := events.NewBroker(10)
+	handlers.SetEventBroker(broker)
+
+	header := http.Header{}
+	header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("admin:password123")))
+	conn, _, err := dialWebSocket(t, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]string{"action": "subscribe", "topic": "students.grade=A"})
+	if reply := readReply(t, conn); reply.Type != "subscribed" || reply.Topic != "students.grade=A" {
+		t.Fatalf("Unexpected reply %+v", reply)
+	}
+
+	conn.WriteJSON(map[string]string{"action": "subscribe", "topic": "teachers"})
+	if reply := readReply(t, conn); reply.Type != "error" {
+		t.Errorf("Expected error for unknown topic, got %+v", reply)
+	}
+
+	broker.Publish(events.StudentCreated, models.Student{Name: "Efaz", Grade: "B"})
+	broker.Publish(events.StudentCreated, models.Student{Name: "Al Mamun", Grade: "A"})
+
+	// The grade B event is filtered out, so the first event seen is grade A
+	reply := readReply(t, conn)
+	if reply.Type != "event" || reply.Event == nil || reply.Event.Student.Name != "Al Mamun" {
+		t.Fatalf("Unexpected reply %+v", reply)
+	}
+	if len(reply.Topics) != 1 || reply.Topics[0] != "students.grade=A" {
+		t.Errorf("Unexpected topics %v", reply.Topics)
+	}
+}
+
+func TestWebSocketSubscriptionLimit(t *testing.T) {
+	handlers.SetEventBroker(events.NewBroker(10))
+	old := handlers.MaxSubscriptionsPerConn
+	handlers.MaxSubscriptionsPerConn = 2
+	defer func() { handlers.MaxSubscriptionsPerConn = old }()
+
+	header := http.Header{}
+	header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("admin:password123")))
+	conn, _, err := dialWebSocket(t, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for _, topic := range []string{"students", "students.id=1", "students.id=2"} {
+		conn.WriteJSON(map[string]string{"action": "subscribe", "topic": topic})
+	}
+	readReply(t, conn)
+	readReply(t, conn)
+	if reply := readReply(t, conn); reply.Type != "error" || !strings.Contains(reply.Error, "limit") {
+		t.Errorf("Expected subscription limit error, got %+v", reply)
+	}
+}
@@ -0,0 +1,122 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CertReloader serves a certificate and key pair read from files, and
+// swaps in the new pair when the files change. A pair that fails to load
+// is reported and the previous one stays in use, so a half-written
+// renewal never takes the server down.
+type CertReloader struct {
+	mu       sync.Mutex // guards the fields below
+	certFile string
+	keyFile  string
+	modTimes [2]time.Time
+
+	cert atomic.Pointer[tls.Certificate]
+}
+
+// NewCertReloader loads the pair in certFile and keyFile
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate; it is meant for
+// tls.Config.GetCertificate
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// Certificate returns the parsed leaf of the current certificate
+func (r *CertReloader) Certificate() *x509.Certificate {
+	return r.cert.Load().Leaf
+}
+
+// Reload reads the files again
+func (r *CertReloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.load()
+}
+
+// SetFiles switches to the pair in certFile and keyFile. The current
+// files stay in use if the new pair can't be loaded.
+func (r *CertReloader) SetFiles(certFile, keyFile string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	previousCert, previousKey := r.certFile, r.keyFile
+	r.certFile, r.keyFile = certFile, keyFile
+	if err := r.load(); err != nil {
+		r.certFile, r.keyFile = previousCert, previousKey
+		return err
+	}
+	return nil
+}
+
+func (r *CertReloader) load() error {
+	modTimes, err := r.stat()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	r.cert.Store(&cert)
+	r.modTimes = modTimes
+	return nil
+}
+
+func (r *CertReloader) stat() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for i, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+// Watch checks the files every interval until ctx is done and reloads
+// them when either has been modified
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		r.mu.Lock()
+		modTimes, err := r.stat()
+		if err == nil && modTimes != r.modTimes {
+			if err = r.load(); err == nil {
+				slog.Info("reloaded TLS certificate", "file", r.certFile, "expires", r.cert.Load().Leaf.NotAfter)
+			} else {
+				// Report a broken pair once, not on every check
+				r.modTimes = modTimes
+			}
+		}
+		r.mu.Unlock()
+		if err != nil {
+			slog.Error("failed to reload TLS certificate", "error", err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Package tracing sets up OpenTelemetry tracing for the server: spans for
+// HTTP requests, database statements and outbound webhook calls, with W3C
+// trace context carried across them
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporters
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp" // OTLP over gRPC
+)
+
+// Config describes where spans are sent
+type Config struct {
+	Exporter    string  `yaml:"exporter" toml:"exporter"` // ExporterNone, ExporterStdout or ExporterOTLP
+	Endpoint    string  `yaml:"endpoint" toml:"endpoint"` // OTLP collector host:port; empty uses OTEL_EXPORTER_OTLP_ENDPOINT or localhost:4317
+	Insecure    bool    `yaml:"insecure" toml:"insecure"` // talk to the collector without TLS
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio"`
+	ServiceName string  `yaml:"service_name" toml:"service_name"`
+}
+
+// DefaultConfig returns a configuration with tracing turned off
+func DefaultConfig() Config {
+	return Config{Exporter: ExporterNone, SampleRatio: 1, ServiceName: "student-server"}
+}
+
+// propagator reads and writes W3C traceparent/tracestate and baggage
+// headers. It is used directly rather than through the global propagator
+// so trace context is carried even when no exporter is configured.
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Tracer returns the server's tracer from the global provider
+func Tracer() trace.Tracer {
+	return otel.Tracer("student-server")
+}
+
+// Setup installs a global tracer provider for cfg and returns a function
+// that flushes and stops it. With ExporterNone spans are not recorded.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagator)
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return nil, fmt.Errorf("invalid trace sample ratio %v (want 0 to 1)", cfg.SampleRatio)
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		var opts []otlptracegrpc.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q (want none, stdout or otlp)", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", cfg.Exporter, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// TraceParent returns the W3C traceparent of the span in ctx, or "" if
+// there is none. It is stored with queued work so the trace can be
+// continued when the work runs.
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// ContextWithTraceParent returns ctx carrying the remote span described by
+// traceParent, so spans started from it join that trace
+func ContextWithTraceParent(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	return propagator.Extract(ctx, propagation.MapCarrier{"traceparent": traceParent})
+}
@@ -0,0 +1,257 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"student-server/events"
+	"student-server/models"
+	"student-server/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// payload is the JSON body posted to subscribers
+type payload struct {
+	Type    events.Type    `json:"type"`
+	Time    time.Time      `json:"time"`
+	Student models.Student `json:"student"`
+}
+
+// Dispatcher queues webhook deliveries in the database and sends them
+// with exponential backoff. Deliveries that keep failing are marked dead
+// after MaxAttempts and can be redelivered by hand.
+type Dispatcher struct {
+	DB           *gorm.DB
+	Client       *http.Client
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	PollInterval time.Duration
+	BatchSize    int
+	// LockTimeout is how long a claimed delivery is hidden from other
+	// workers, so a crashed worker's deliveries are eventually retried
+	LockTimeout time.Duration
+}
+
+// NewDispatcher creates a dispatcher with default retry settings
+func NewDispatcher(db *gorm.DB) *Dispatcher {
+	return &Dispatcher{
+		DB:           db,
+		Client:       &http.Client{Timeout: 10 * time.Second, Transport: tracing.Transport(safeTransport())},
+		MaxAttempts:  8,
+		BaseBackoff:  10 * time.Second,
+		MaxBackoff:   time.Hour,
+		PollInterval: time.Second,
+		BatchSize:    50,
+		LockTimeout:  time.Minute,
+	}
+}
+
+// Enqueue queues a delivery of the event for every active subscription
+// that wants it
+func (d *Dispatcher) Enqueue(ctx context.Context, t events.Type, student models.Student) error {
+	db := d.DB.WithContext(ctx)
+	var subs []models.WebhookSubscription
+	if err := db.Where("active = ?", true).Find(&subs).Error; err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(payload{Type: t, Time: time.Now().UTC(), Student: student})
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range subs {
+		if !sub.Wants(string(t)) {
+			continue
+		}
+		delivery := models.WebhookDelivery{
+			SubscriptionID: sub.ID,
+			EventType:      string(t),
+			Payload:        string(body),
+			Status:         models.DeliveryPending,
+			NextAttemptAt:  time.Now(),
+			TraceParent:    tracing.TraceParent(ctx),
+		}
+		if err := db.Create(&delivery).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run sends due deliveries every PollInterval until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := d.ProcessDue(ctx); err != nil {
+				slog.Error("webhook dispatch failed", "error", err)
+			}
+		}
+	}
+}
+
+// ProcessDue attempts every pending delivery whose retry time has come and
+// returns how many were attempted
+func (d *Dispatcher) ProcessDue(ctx context.Context) (int, error) {
+	now := time.Now()
+	var due []models.WebhookDelivery
+	err := d.DB.WithContext(ctx).Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, now).
+		Where("locked_until IS NULL OR locked_until < ?", now).
+		Order("next_attempt_at").Limit(d.BatchSize).Find(&due).Error
+	if err != nil {
+		return 0, err
+	}
+
+	attempted := 0
+	for _, delivery := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		if !d.claim(ctx, delivery.ID, now) {
+			continue
+		}
+		d.attempt(ctx, delivery)
+		attempted++
+	}
+	return attempted, nil
+}
+
+// claim locks a delivery so concurrent workers don't send it twice
+func (d *Dispatcher) claim(ctx context.Context, id uint, now time.Time) bool {
+	until := now.Add(d.LockTimeout)
+	result := d.DB.WithContext(ctx).Model(&models.WebhookDelivery{}).
+		Where("id = ? AND (locked_until IS NULL OR locked_until < ?)", id, now).
+		Update("locked_until", until)
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, delivery models.WebhookDelivery) {
+	// Each attempt joins the trace of the event that queued the delivery
+	ctx, span := tracing.Tracer().Start(tracing.ContextWithTraceParent(ctx, delivery.TraceParent), "webhook.deliver "+delivery.EventType,
+		trace.WithAttributes(
+			attribute.Int64("webhook.delivery_id", int64(delivery.ID)),
+			attribute.Int("webhook.attempt", delivery.Attempts+1),
+		),
+	)
+	defer span.End()
+
+	var sub models.WebhookSubscription
+	if err := d.DB.WithContext(ctx).First(&sub, delivery.SubscriptionID).Error; err != nil {
+		// The subscription was removed; nobody is left to deliver to
+		d.finish(delivery, models.WebhookAttempt{Error: "subscription not found"}, models.DeliveryDead)
+		return
+	}
+
+	start := time.Now()
+	status, err := d.send(ctx, sub, delivery)
+	record := models.WebhookAttempt{
+		DeliveryID: delivery.ID,
+		StatusCode: status,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err == nil && (status < 200 || status > 299) {
+		err = fmt.Errorf("receiver returned %d", status)
+	}
+	if err != nil {
+		record.Error = err.Error()
+		span.SetStatus(codes.Error, record.Error)
+	}
+
+	delivery.Attempts++
+	switch {
+	case err == nil:
+		d.finish(delivery, record, models.DeliverySucceeded)
+	case delivery.Attempts >= d.MaxAttempts:
+		slog.Warn("webhook delivery failed too often, giving up", "delivery_id", delivery.ID, "url", sub.URL, "attempts", delivery.Attempts, "error", err)
+		d.finish(delivery, record, models.DeliveryDead)
+	default:
+		delivery.NextAttemptAt = time.Now().Add(d.backoff(delivery.Attempts))
+		d.finish(delivery, record, models.DeliveryPending)
+	}
+}
+
+func (d *Dispatcher) send(ctx context.Context, sub models.WebhookSubscription, delivery models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "student-server-webhooks/1.0")
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, time.Now(), body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+// finish logs the attempt and stores the delivery's new state. It ignores
+// cancellation so an attempt made during shutdown is still recorded.
+func (d *Dispatcher) finish(delivery models.WebhookDelivery, record models.WebhookAttempt, status string) {
+	record.DeliveryID = delivery.ID
+	delivery.Status = status
+	delivery.LastError = record.Error
+	delivery.LockedUntil = nil
+
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+		return tx.Model(&delivery).Select("status", "attempts", "next_attempt_at", "locked_until", "last_error").
+			Updates(&delivery).Error
+	})
+	if err != nil {
+		slog.Error("failed to record webhook delivery", "delivery_id", delivery.ID, "error", err)
+	}
+}
+
+// backoff returns the delay before retry number attempts+1
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.BaseBackoff
+	for i := 1; i < attempts && delay < d.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, d.MaxBackoff)
+}
+
+// Redeliver puts a delivery back on the queue to be sent immediately,
+// whatever its current state
+func Redeliver(db *gorm.DB, id uint) error {
+	result := db.Model(&models.WebhookDelivery{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":          models.DeliveryPending,
+		"attempts":        0,
+		"next_attempt_at": time.Now(),
+		"locked_until":    nil,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
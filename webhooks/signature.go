@@ -0,0 +1,61 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader carries the HMAC of each delivery in the form
+// "t=<unix timestamp>,v1=<hex HMAC-SHA256 of "<timestamp>.<body>">"
+const SignatureHeader = "X-Webhook-Signature"
+
+// Sign computes the signature header value for body sent at timestamp
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + ts + ",v1=" + computeMAC(secret, ts, body)
+}
+
+// Verify checks a signature header against body, rejecting signatures
+// older than tolerance so captured requests can't be replayed later.
+// Receivers can use it as-is.
+func Verify(secret, header string, body []byte, tolerance time.Duration) error {
+	var ts, mac string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			mac = value
+		}
+	}
+	if ts == "" || mac == "" {
+		return errors.New("malformed signature header")
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errors.New("malformed signature timestamp")
+	}
+	if tolerance > 0 && time.Since(time.Unix(unix, 0)) > tolerance {
+		return errors.New("signature timestamp too old")
+	}
+
+	if !hmac.Equal([]byte(mac), []byte(computeMAC(secret, ts, body))) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+func computeMAC(secret, ts string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(ts))
+	h.Write([]byte("."))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
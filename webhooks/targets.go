@@ -0,0 +1,139 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenTarget is returned for webhook URLs that resolve to an
+// address subscribers may not reach
+var ErrForbiddenTarget = errors.New("webhook target address is not allowed")
+
+// Config restricts where webhooks may be sent
+type Config struct {
+	// AllowedNetworks are CIDR ranges or addresses that may be targeted
+	// even though they are loopback, private or link-local, for receivers
+	// inside the server's own network
+	AllowedNetworks []string `yaml:"allowed_networks" toml:"allowed_networks"`
+}
+
+// Validate reports settings that can't work
+func (c Config) Validate() error {
+	_, err := parseNetworks(c.AllowedNetworks)
+	return err
+}
+
+var allowedNetworks atomic.Pointer[[]netip.Prefix]
+
+func init() {
+	allowedNetworks.Store(&[]netip.Prefix{})
+}
+
+// SetConfig replaces the target restrictions. It is safe to call while
+// deliveries are being sent.
+func SetConfig(c Config) error {
+	prefixes, err := parseNetworks(c.AllowedNetworks)
+	if err != nil {
+		return err
+	}
+	allowedNetworks.Store(&prefixes)
+	return nil
+}
+
+func parseNetworks(networks []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(networks))
+	for _, network := range networks {
+		if !strings.Contains(network, "/") {
+			addr, err := netip.ParseAddr(network)
+			if err != nil {
+				return nil, fmt.Errorf("allowed network %q is not an address or CIDR range", network)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			return nil, fmt.Errorf("allowed network %q is not an address or CIDR range", network)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, internal to providers
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// allowedAddr reports whether webhooks may be sent to addr: any public
+// unicast address, or one in the allowed networks. Loopback, private,
+// link-local (cloud metadata services included), multicast and unspecified
+// addresses are refused.
+func allowedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range *allowedNetworks.Load() {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// CheckURL checks that rawURL is an http or https URL whose host resolves
+// only to allowed addresses. Deliveries are checked again when they are
+// dialed, as DNS answers can change in between.
+func CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("webhook URL must be an absolute http or https URL")
+	}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil {
+		if !allowedAddr(addr) {
+			return ErrForbiddenTarget
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return fmt.Errorf("cannot resolve webhook host %q", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if !allowedAddr(addr) {
+			return ErrForbiddenTarget
+		}
+	}
+	return nil
+}
+
+// safeTransport dials only allowed addresses, checking the address actually
+// connected to so redirects and DNS rebinding can't reach internal hosts.
+// Proxies from the environment are ignored, as they would be dialed instead
+// of the target.
+func safeTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !allowedAddr(addrPort.Addr()) {
+				return ErrForbiddenTarget
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}